@@ -0,0 +1,261 @@
+// Command arkitect runs and checks architecture files without the web UI.
+//
+//	arkitect validate <file>
+//	arkitect run    [-ticks N] [-seed S] [-assert EXPR]... <file>
+//	arkitect report [-ticks N] [-seed S] [-assert EXPR]... <file>
+//
+// validate lints the architecture and reports errors and warnings; only
+// errors fail it. run simulates the architecture headlessly and prints the
+// full tick series and summary as JSON; report prints a readable summary
+// instead. Both check the SLOs listed in the file's "slos" field and on its
+// request classes, plus any -assert flags, and exit with status 1 if one
+// fails. A file of "-" reads the architecture from stdin.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"arkitect/engine"
+)
+
+// Exit codes.
+const (
+	exitOK       = 0
+	exitSLOFail  = 1
+	exitBadInput = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitBadInput
+	}
+
+	switch args[0] {
+	case "validate":
+		return validate(args[1:], stdin, stdout, stderr)
+	case "run", "report":
+		return simulate(args[0], args[1:], stdin, stdout, stderr)
+	case "help", "-h", "--help":
+		usage(stdout)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "arkitect: unknown command %q\n", args[0])
+		usage(stderr)
+		return exitBadInput
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, `usage:
+  arkitect validate <file>
+  arkitect run    [-ticks N] [-seed S] [-assert EXPR]... <file>
+  arkitect report [-ticks N] [-seed S] [-assert EXPR]... <file>
+
+SLO expressions look like "p99 <= 250" or "api.successRate >= 0.999".`)
+}
+
+// readFile reads an architecture file, or stdin for "-".
+func readFile(path string, stdin io.Reader) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func validate(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		fmt.Fprintln(stderr, "usage: arkitect validate <file>")
+		return exitBadInput
+	}
+	path := fs.Arg(0)
+
+	data, err := readFile(path, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "arkitect: %v\n", err)
+		return exitBadInput
+	}
+	var config engine.ArchitectureConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		fmt.Fprintf(stderr, "%s: invalid architecture JSON: %v\n", path, err)
+		return exitBadInput
+	}
+
+	failed := false
+	for _, f := range engine.Validate(&config, engine.DefaultRules) {
+		fmt.Fprintf(stderr, "%s: %s: %s [%s]\n", path, f.Severity, f.Message, f.Rule)
+		failed = failed || f.Severity == engine.SeverityError
+	}
+	if failed {
+		return exitBadInput
+	}
+	fmt.Fprintf(stdout, "%s: ok (%d nodes)\n", path, len(config.Nodes))
+	return exitOK
+}
+
+// assertions collects repeated -assert flags.
+type assertions []string
+
+func (a *assertions) String() string     { return strings.Join(*a, ", ") }
+func (a *assertions) Set(v string) error { *a = append(*a, v); return nil }
+
+func simulate(cmd string, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	ticks := fs.Int("ticks", 60, "number of ticks to simulate")
+	seed := fs.Int64("seed", 0, "random seed (overrides the file's seed)")
+	var asserts assertions
+	fs.Var(&asserts, "assert", "SLO assertion, e.g. \"p99 <= 250\" (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return exitBadInput
+	}
+	if fs.NArg() != 1 || *ticks < 1 {
+		fmt.Fprintf(stderr, "usage: arkitect %s [-ticks N] [-seed S] [-assert EXPR]... <file>\n", cmd)
+		return exitBadInput
+	}
+	path := fs.Arg(0)
+
+	data, err := readFile(path, stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "arkitect: %v\n", err)
+		return exitBadInput
+	}
+	var config engine.ArchitectureConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		fmt.Fprintf(stderr, "%s: invalid architecture JSON: %v\n", path, err)
+		return exitBadInput
+	}
+	if *seed != 0 {
+		config.Seed = *seed
+	}
+
+	var slos []engine.SLO
+	for _, expr := range append(config.SLOExprs(), asserts...) {
+		slo, err := engine.ParseSLO(expr)
+		if err != nil {
+			fmt.Fprintf(stderr, "arkitect: %v\n", err)
+			return exitBadInput
+		}
+		slos = append(slos, slo)
+	}
+
+	graph, err := engine.BuildGraphFromConfig(&config)
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\n", path, err)
+		return exitBadInput
+	}
+	// Only "run" prints the per-tick series.
+	result := engine.RunFor(graph, *ticks, cmd == "run")
+
+	var checks []engine.SLOResult
+	failed := 0
+	for _, slo := range slos {
+		check, err := slo.Check(result.Summary)
+		if err != nil {
+			fmt.Fprintf(stderr, "arkitect: %v\n", err)
+			return exitBadInput
+		}
+		if !check.Passed {
+			failed++
+		}
+		checks = append(checks, check)
+	}
+
+	if cmd == "run" {
+		out := struct {
+			*engine.RunResult
+			SLOs []engine.SLOResult `json:"slos,omitempty"`
+		}{result, checks}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			fmt.Fprintf(stderr, "arkitect: %v\n", err)
+			return exitBadInput
+		}
+		for _, c := range checks {
+			if !c.Passed {
+				fmt.Fprintf(stderr, "SLO failed: %s (actual %.4g)\n", c.Expr, c.Actual)
+			}
+		}
+	} else {
+		report(stdout, path, result.Summary, checks)
+	}
+
+	if failed > 0 {
+		return exitSLOFail
+	}
+	return exitOK
+}
+
+// report prints a readable summary of a run.
+func report(w io.Writer, path string, s engine.RunSummary, checks []engine.SLOResult) {
+	fmt.Fprintf(w, "%s: %d ticks, %.0fs simulated, seed %d\n", path, s.Ticks, s.SimSeconds, s.Seed)
+	fmt.Fprintf(w, "Traffic: %.1f rps\n", s.AvgTotalRPS)
+	fmt.Fprintf(w, "Success rate: %.3f%% (%.0f ok, %.0f failed)\n\n", s.SuccessRate*100, s.Succeeded, s.Failed)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLIENT\tAVG RPS\tSUCCESS\tP50\tP99\tMAX")
+	for _, c := range s.Clients {
+		fmt.Fprintf(tw, "%s\t%.1f\t%.3f%%\t%.1fms\t%.1fms\t%.1fms\n",
+			c.ID, c.AvgInjectedRPS, c.SuccessRate*100, c.LatencyP50, c.LatencyP99, c.LatencyMax)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+
+	if len(s.Classes) > 0 {
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "CLASS\tAVG RPS\tSUCCESS\tP50\tP99\tMAX")
+		for _, c := range s.Classes {
+			fmt.Fprintf(tw, "%s\t%.1f\t%.3f%%\t%.1fms\t%.1fms\t%.1fms\n",
+				c.Name, c.AvgInjectedRPS, c.SuccessRate*100, c.LatencyP50, c.LatencyP99, c.LatencyMax)
+		}
+		tw.Flush()
+		fmt.Fprintln(w)
+	}
+
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tTYPE\tAVG UTIL\tPEAK UTIL\tAVG RPS\tPEAK QUEUE\tDROPPED\tSUCCESS\tP50\tP99")
+	for _, n := range s.Nodes {
+		fmt.Fprintf(tw, "%s\t%s\t%.0f%%\t%.0f%%\t%.1f\t%.0f\t%.0f\t%.3f%%\t%.1fms\t%.1fms\n",
+			n.ID, n.Type, n.AvgUtilization*100, n.PeakUtilization*100, n.AvgThroughput,
+			n.PeakQueueDepth, n.Dropped, n.SuccessRate*100, n.LatencyP50, n.LatencyP99)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+
+	if len(s.Bottlenecks) == 0 {
+		fmt.Fprintln(w, "Bottlenecks: none")
+	} else {
+		fmt.Fprintln(w, "Bottlenecks:")
+		for _, id := range s.Bottlenecks {
+			for _, n := range s.Nodes {
+				if n.ID == id {
+					fmt.Fprintf(w, "  %s (%d/%d ticks)\n", id, n.BottleneckTicks, s.Ticks)
+				}
+			}
+		}
+	}
+
+	if len(checks) > 0 {
+		fmt.Fprintln(w, "\nSLOs:")
+		for _, c := range checks {
+			status := "PASS"
+			if !c.Passed {
+				status = "FAIL"
+			}
+			fmt.Fprintf(w, "  %s  %s (actual %.4g)\n", status, c.Expr, c.Actual)
+		}
+	}
+}
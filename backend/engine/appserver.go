@@ -9,6 +9,7 @@ type AppServer struct {
 	BaseNode
 	CapacityRPS float64
 	BaseLatency float64 // ms
+	ServiceCV   float64 // coefficient of variation of service time (0 = deterministic)
 
 	queueDepth       float64
 	throughput       float64
@@ -19,6 +20,9 @@ type AppServer struct {
 	utilization      float64
 	ConcurrencyLimit float64
 	effectiveLim     float64
+	retry            retrier       // retries of failed downstream calls
+	scaling          autoscaler    // instance pool, when autoscaling is configured
+	health           healthChecker // health checks of downstream nodes
 }
 
 // NewAppServer creates a new AppServer node.
@@ -37,11 +41,18 @@ func NewAppServer(id, label string, maxRPS, baseLatency float64) *AppServer {
 // Process handles incoming traffic with capacity constraints.
 // If this node is DOWN, it is skipped entirely — no traffic is processed or forwarded.
 func (s *AppServer) Process() {
+	// Instances keep provisioning even while the server is down.
+	if s.scaling.enabled() {
+		if msg := s.scaling.next(); msg != "" {
+			s.emit("instances-ready", msg)
+		}
+		s.CapacityRPS = s.scaling.capacity()
+	}
 	if s.Down {
 		s.throughput = 0
 		s.utilization = 0
 		s.dropped = 0
-		s.ResetIncoming()
+		s.failIncoming()
 		return
 	}
 
@@ -49,15 +60,29 @@ func (s *AppServer) Process() {
 	inWrite := s.IncomingWrite
 	inTotal := s.Incoming + inRead + inWrite
 	s.ResetIncoming()
+	s.health.probe(&s.BaseNode, s.Downstream())
 
 	// Proportional split if generic traffic exists
 	if inTotal > 0 && inRead == 0 && inWrite == 0 {
-		inRead = inTotal * 0.7
-		inWrite = inTotal * 0.3
+		inRead = inTotal * defaultReadRatio
+		inWrite = inTotal * (1 - defaultReadRatio)
+	}
+
+	// Downstream calls being retried are handled again, with the current mix.
+	if retries := s.retry.next(inTotal) - inTotal; retries > 0 {
+		readShare := defaultReadRatio
+		if inTotal > 0 {
+			readShare = inRead / inTotal
+		}
+		inRead += retries * readShare
+		inWrite += retries * (1 - readShare)
+		inTotal += retries
 	}
 
-	totalLatency := s.CurrentLatency()
-	effectiveCapacity := s.CapacityRPS
+	dt := s.tickSeconds()
+	totalLatency := latencyOf(s)
+	ratedRPS := s.derate(s.CapacityRPS)
+	effectiveCapacity := sampleCapacity(s.random(), ratedRPS, s.ServiceCV, dt)
 
 	if s.ConcurrencyLimit > 0 && totalLatency > 0 {
 		// Note: Logic kept for schema compatibility, but we effectively disable it
@@ -69,46 +94,64 @@ func (s *AppServer) Process() {
 		s.effectiveLim = 0
 	}
 
-	totalArrival := inTotal + s.queueDepth
+	// Rates are per second; the queue holds requests, so it can be cleared
+	// at queueDepth/dt per second within this tick.
+	queued := s.queueDepth / dt
+	totalArrival := inTotal + queued
 	processed := math.Min(totalArrival, effectiveCapacity)
 	s.throughput = processed
 
 	// Proportional split for throughput metrics (using integers for downstream consistency)
 	if totalArrival > 0 {
 		ratio := processed / totalArrival
-		s.readTP = (inRead + (s.queueDepth * (inRead / math.Max(1, inTotal)))) * ratio
-		s.writeTP = (inWrite + (s.queueDepth * (inWrite / math.Max(1, inTotal)))) * ratio
+		s.readTP = (inRead + (queued * (inRead / math.Max(1, inTotal)))) * ratio
+		s.writeTP = (inWrite + (queued * (inWrite / math.Max(1, inTotal)))) * ratio
 	}
 
-	s.queueDepth = math.Max(0.0, totalArrival-processed)
+	s.classes.service = s.BaseLatency
+	s.localLatency = serverLatency(s.BaseLatency, s.ServiceCV, s.arrivalVar, s.queueDepth, inTotal, effectiveCapacity, ratedRPS, dt)
+	s.served = processed
+
+	s.queueDepth = math.Max(0.0, (totalArrival-processed)*dt)
 
+	// The queue holds at most 5 seconds of work.
 	maxQueue := s.CapacityRPS * 5.0
 	if s.queueDepth > maxQueue {
-		s.dropped = s.queueDepth - maxQueue
-		s.totalDropped += s.dropped
+		excess := s.queueDepth - maxQueue
+		s.dropped = excess / dt
+		s.totalDropped += excess
+		s.lost = s.dropped
 		s.queueDepth = maxQueue
 	} else {
 		s.dropped = 0
 	}
 
-	if s.CapacityRPS > 0.0 {
-		s.utilization = math.Min(inTotal/s.CapacityRPS, 1.0)
+	if ratedRPS > 0.0 {
+		s.utilization = math.Min(inTotal/ratedRPS, 1.0)
 		if s.queueDepth > 0 || processed < totalArrival-0.1 {
 			// Force 100% util if queue exists OR if we are throttled by capacity
 			s.utilization = 1.0
 		}
 	}
 
+	if s.scaling.enabled() {
+		if kind, msg := s.scaling.evaluate(inTotal, s.queueDepth, dt); kind != "" {
+			s.emit(kind, msg)
+		}
+	}
+
 	// Forward to healthy nodes only
 	downstream := s.Downstream()
 	var healthy []Node
 	for _, node := range downstream {
-		if !node.IsDown() {
+		if s.health.healthy(node) {
 			healthy = append(healthy, node)
 		}
 	}
 
-	if len(healthy) > 0 && processed > 0.0 {
+	if len(healthy) == 0 {
+		s.unroutable(processed)
+	} else if processed > 0.0 {
 		var primaries []Node
 		for _, n := range healthy {
 			if db, ok := n.(*Database); ok {
@@ -135,7 +178,7 @@ func (s *AppServer) Process() {
 				if i < remainder {
 					val += 1.0
 				}
-				node.AddIncomingWrite(val)
+				s.forward(node, val, true)
 			}
 		}
 
@@ -150,7 +193,7 @@ func (s *AppServer) Process() {
 				if i < remainder {
 					val += 1.0
 				}
-				node.AddIncomingRead(val)
+				s.forward(node, val, false)
 			}
 		}
 	}
@@ -162,19 +205,40 @@ func (s *AppServer) CurrentLatency() float64 {
 	if len(downstream) > 0 {
 		sum := 0.0
 		for _, node := range downstream {
-			sum += node.CurrentLatency()
+			sum += latencyOf(node)
 		}
 		downstreamLatency = sum / float64(len(downstream))
 	}
 	queueDelay := 0.0
-	if s.CapacityRPS > 0 {
-		queueDelay = (s.queueDepth / s.CapacityRPS) * 1000.0
+	if rated := s.derate(s.CapacityRPS); rated > 0 {
+		queueDelay = (s.queueDepth / rated) * 1000.0
 	}
 	return s.BaseLatency + downstreamLatency + queueDelay
 }
 
+// Settle retries downstream calls that failed or timed out. Requests dropped
+// from this server's own queue are not retried here.
+func (s *AppServer) Settle() {
+	s.BaseNode.Settle()
+	if s.retry.enabled() {
+		failed := s.pathFailed()
+		exhausted := s.retry.schedule(failed, s.tickSeconds())
+		s.retrying = failed - exhausted
+		s.setFailed(s.lost + s.errors + exhausted)
+	}
+}
+
+func (s *AppServer) fillMetrics(m *NodeMetrics) {
+	s.BaseNode.fillMetrics(m)
+	m.Retries = s.retry.retried
+	if s.scaling.enabled() {
+		m.Instances = s.scaling.instances
+		m.PendingInstances = s.scaling.provisioning()
+	}
+}
+
 func (s *AppServer) GetMetrics() NodeMetrics {
-	lat := s.CurrentLatency()
+	lat := latencyOf(s)
 	return NodeMetrics{
 		ID:                s.NodeID,
 		Type:              s.NodeType,
@@ -200,6 +264,7 @@ func (s *AppServer) MaxRPS() float64 {
 }
 
 func (s *AppServer) ResetQueues() {
+	s.retry.reset()
 	s.queueDepth = 0
 	s.throughput = 0
 }
@@ -0,0 +1,163 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// AutoscalePolicy turns an app server into a pool of identical instances that
+// grows and shrinks with load. Durations are in simulated seconds, rounded to
+// whole ticks.
+//   - "target-utilization" sizes the pool so arrivals use TargetUtilization
+//     of its capacity.
+//   - "queue" adds instances while the backlog per instance is above
+//     TargetBacklog and removes one at a time once the queue is empty.
+type AutoscalePolicy struct {
+	MinInstances      int     `json:"minInstances"`
+	MaxInstances      int     `json:"maxInstances"`
+	Policy            string  `json:"policy,omitempty"`            // "target-utilization" (default) or "queue"
+	TargetUtilization float64 `json:"targetUtilization,omitempty"` // 0.0 to 1.0 (default 0.7)
+	TargetBacklog     float64 `json:"targetBacklog,omitempty"`     // queued requests per instance (default 10)
+	ScaleOutCooldown  float64 `json:"scaleOutCooldown,omitempty"`  // seconds between scale-outs
+	ScaleInCooldown   float64 `json:"scaleInCooldown,omitempty"`   // seconds after any scaling before scaling in
+	ProvisionSeconds  float64 `json:"provisionSeconds,omitempty"`  // seconds before a new instance takes traffic
+}
+
+// autoscaler tracks the instances of a pool: those serving traffic and those
+// still being provisioned.
+type autoscaler struct {
+	Policy      *AutoscalePolicy
+	InstanceRPS float64 // capacity of one instance
+
+	tick      int
+	instances int
+	pending   map[int]int // ready tick -> instances
+	lastOut   int
+	lastScale int
+	started   bool
+}
+
+// enabled reports whether the pool scales at all.
+func (a *autoscaler) enabled() bool {
+	return a.Policy != nil && a.Policy.MaxInstances > 0
+}
+
+// limits returns the pool size bounds with min <= max.
+func (a *autoscaler) limits() (int, int) {
+	lo := int(math.Max(1, float64(a.Policy.MinInstances)))
+	hi := int(math.Max(float64(lo), float64(a.Policy.MaxInstances)))
+	return lo, hi
+}
+
+// provisioning returns the number of instances still starting up.
+func (a *autoscaler) provisioning() int {
+	n := 0
+	for _, count := range a.pending {
+		n += count
+	}
+	return n
+}
+
+// capacity returns the capacity of the instances currently serving.
+func (a *autoscaler) capacity() float64 {
+	return float64(a.instances) * a.InstanceRPS
+}
+
+// next starts a new tick and brings instances that finished provisioning
+// online. It returns a message when the pool grew.
+func (a *autoscaler) next() string {
+	a.tick++
+	if !a.started {
+		a.started = true
+		a.instances, _ = a.limits()
+		a.lastOut = -math.MaxInt32
+		a.lastScale = -math.MaxInt32
+	}
+	ready := a.pending[a.tick]
+	if ready == 0 {
+		return ""
+	}
+	delete(a.pending, a.tick)
+	a.instances += ready
+	return fmt.Sprintf("%d instance(s) ready, %d serving", ready, a.instances)
+}
+
+// desired returns the pool size the policy asks for, given this tick's
+// arrivals (per second) and the backlog (requests) left at the end of it.
+// dt is the simulated length of a tick in seconds.
+func (a *autoscaler) desired(arrivals, backlog, dt float64) int {
+	current := a.instances + a.provisioning()
+	if a.Policy.Policy == "queue" {
+		target := a.Policy.TargetBacklog
+		if target <= 0 {
+			target = 10
+		}
+		if backlog <= 0 {
+			return current - 1
+		}
+		if backlog/float64(a.instances) <= target {
+			return current
+		}
+		return int(math.Ceil(backlog / target))
+	}
+
+	target := a.Policy.TargetUtilization
+	if target <= 0 || target > 1 {
+		target = 0.7
+	}
+	if a.InstanceRPS <= 0 {
+		return current
+	}
+	// Queued work counts as demand too (cleared over one tick), or a
+	// saturated pool would look exactly as busy as one at 100%.
+	demand := arrivals + backlog/dt
+	return int(math.Ceil(demand / (a.InstanceRPS * target)))
+}
+
+// evaluate applies the policy at the end of a tick and returns a description
+// of the scaling action taken, if any.
+func (a *autoscaler) evaluate(arrivals, backlog, dt float64) (kind, message string) {
+	lo, hi := a.limits()
+	want := int(math.Max(float64(lo), math.Min(float64(hi), float64(a.desired(arrivals, backlog, dt)))))
+	current := a.instances + a.provisioning()
+
+	switch {
+	case want > current:
+		if a.tick-a.lastOut < ticksFor(a.Policy.ScaleOutCooldown, dt) {
+			return "", ""
+		}
+		add := want - current
+		if a.pending == nil {
+			a.pending = make(map[int]int)
+		}
+		a.pending[a.tick+int(math.Max(1, float64(ticksFor(a.Policy.ProvisionSeconds, dt))))] += add
+		a.lastOut, a.lastScale = a.tick, a.tick
+		return "scale-out", fmt.Sprintf("launching %d instance(s), %d -> %d", add, current, want)
+	case want < current:
+		if a.tick-a.lastScale < ticksFor(a.Policy.ScaleInCooldown, dt) {
+			return "", ""
+		}
+		// Cancel the newest instances still starting before removing
+		// serving ones.
+		remove := current - want
+		dues := make([]int, 0, len(a.pending))
+		for due := range a.pending {
+			dues = append(dues, due)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(dues)))
+		for _, due := range dues {
+			count := a.pending[due]
+			cancel := int(math.Min(float64(count), float64(remove)))
+			a.pending[due] -= cancel
+			remove -= cancel
+			if a.pending[due] == 0 {
+				delete(a.pending, due)
+			}
+		}
+		a.instances -= remove
+		a.lastScale = a.tick
+		return "scale-in", fmt.Sprintf("removing %d instance(s), %d -> %d", current-want, current, want)
+	}
+	return "", ""
+}
@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+// scaled is chain(rps) with api a pool of 50 rps instances scaled by policy.
+func scaled(rps float64, policy *AutoscalePolicy) *ArchitectureConfig {
+	config := chain(rps)
+	setNode(config, "api", func(nc *NodeConfig) {
+		nc.MaxRPS = 50
+		nc.Autoscale = policy
+	})
+	return config
+}
+
+// instancesOf returns the serving and provisioning instances of api per tick.
+func instancesOf(t *testing.T, r *RunResult, ticks int) (serving, pending []int) {
+	t.Helper()
+	for i := 1; i <= ticks; i++ {
+		m := nodeAt(t, r, i, "api")
+		serving = append(serving, m.Instances)
+		pending = append(pending, m.PendingInstances)
+	}
+	return serving, pending
+}
+
+// At 50% target utilization 100 rps needs four instances. The first tick's
+// backlog asks for all five, and the extra one goes again as soon as the five
+// have cleared it.
+func TestAutoscaleTargetUtilization(t *testing.T) {
+	r := run(t, scaled(100, &AutoscalePolicy{MinInstances: 1, MaxInstances: 5, TargetUtilization: 0.5, ProvisionSeconds: 3}), 10)
+	serving, pending := instancesOf(t, r, 10)
+	if want := []int{1, 1, 1, 4, 4, 4, 4, 4, 4, 4}; !reflect.DeepEqual(serving, want) {
+		t.Errorf("serving %v, want %v", serving, want)
+	}
+	if want := []int{4, 4, 4, 0, 0, 0, 0, 0, 0, 0}; !reflect.DeepEqual(pending, want) {
+		t.Errorf("provisioning %v, want %v", pending, want)
+	}
+	if got := nodeAt(t, r, 3, "api").QueueDepth; got != 150 {
+		t.Errorf("queued %v while instances started, want 150", got)
+	}
+	if got := nodeAt(t, r, 4, "api"); got.QueueDepth != 0 || got.Throughput != 250 {
+		t.Errorf("served %v with %v queued once ready, want the backlog cleared", got.Throughput, got.QueueDepth)
+	}
+	if out, in := len(eventsOf(r, "scale-out")), len(eventsOf(r, "scale-in")); out != 1 || in != 1 {
+		t.Errorf("%d scale-outs and %d scale-ins, want 1 each", out, in)
+	}
+}
+
+// A scale-in cooldown holds the pool after scaling.
+func TestAutoscaleScaleInCooldown(t *testing.T) {
+	r := run(t, scaled(100, &AutoscalePolicy{MinInstances: 1, MaxInstances: 5, TargetUtilization: 0.5, ProvisionSeconds: 3, ScaleInCooldown: 8}), 10)
+	serving, _ := instancesOf(t, r, 10)
+	if want := []int{1, 1, 1, 5, 5, 5, 5, 5, 4, 4}; !reflect.DeepEqual(serving, want) {
+		t.Errorf("serving %v, want %v", serving, want)
+	}
+}
+
+// The pool never grows past MaxInstances, however far behind it is.
+func TestAutoscaleMaxInstances(t *testing.T) {
+	r := run(t, scaled(1000, &AutoscalePolicy{MinInstances: 1, MaxInstances: 5}), 20)
+	if got := nodeAt(t, r, 20, "api"); got.Instances != 5 || got.Throughput != 250 {
+		t.Errorf("%d instances serving %v rps, want 5 serving 250", got.Instances, got.Throughput)
+	}
+	if r.Summary.SuccessRate >= 1 {
+		t.Error("a pool at its limit failed nothing")
+	}
+}
+
+// The queue policy adds instances for the backlog and removes one at a time
+// once it's gone.
+func TestAutoscaleQueue(t *testing.T) {
+	r := run(t, scaled(100, &AutoscalePolicy{MinInstances: 1, MaxInstances: 5, Policy: "queue", TargetBacklog: 20, ProvisionSeconds: 2}), 7)
+	serving, pending := instancesOf(t, r, 7)
+	if want := []int{1, 1, 3, 4, 3, 2, 1}; !reflect.DeepEqual(serving, want) {
+		t.Errorf("serving %v, want %v", serving, want)
+	}
+	if want := []int{2, 4, 2, 0, 0, 0, 0}; !reflect.DeepEqual(pending, want) {
+		t.Errorf("provisioning %v, want %v", pending, want)
+	}
+	if got := len(eventsOf(r, "scale-in")); got != 4 {
+		t.Errorf("%d scale-ins, want one a tick once the queue was empty", got)
+	}
+}
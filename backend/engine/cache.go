@@ -0,0 +1,267 @@
+package engine
+
+import "math"
+
+// Cache models a Redis/Memcached-style tier sitting in front of slower nodes.
+// Reads are served locally at the current hit ratio; misses and writes are
+// forwarded downstream. A cold cache (at start, or after coming back from DOWN)
+// serves no hits and warms up linearly over WarmupSeconds.
+type Cache struct {
+	BaseNode
+	CapacityRPS   float64
+	BaseLatency   float64 // ms
+	ServiceCV     float64 // coefficient of variation of service time (0 = deterministic)
+	HitRatio      float64 // steady-state hit ratio once fully warm (0.0 to 1.0)
+	WriteMode     string  // "write-through" or "write-around"
+	WarmupSeconds float64 // simulated seconds for a cold cache to reach HitRatio
+	EvictionRate  float64 // fraction of cached entries evicted per second (TTL / memory pressure)
+
+	warmth       float64 // 0.0 (cold) to 1.0 (fully warm)
+	hitRatio     float64 // effective hit ratio of the last tick
+	hits         float64
+	misses       float64
+	queueDepth   float64
+	throughput   float64
+	readTP       float64
+	writeTP      float64
+	dropped      float64 // drops THIS tick
+	totalDropped float64 // accumulated drops since start
+	utilization  float64
+}
+
+// NewCache creates a new, cold Cache node.
+func NewCache(id, label string, maxRPS, baseLatency float64) *Cache {
+	return &Cache{
+		BaseNode: BaseNode{
+			NodeID:    id,
+			NodeType:  "cache",
+			NodeLabel: label,
+		},
+		CapacityRPS:   maxRPS,
+		BaseLatency:   baseLatency,
+		HitRatio:      0.8,
+		WriteMode:     "write-through",
+		WarmupSeconds: 20,
+	}
+}
+
+// SetDown marks the cache UP or DOWN. Going down loses all cached entries,
+// so the cache comes back cold and every read misses until it warms up again.
+func (c *Cache) SetDown(down bool) {
+	if down && !c.Down {
+		c.warmth = 0
+	}
+	c.Down = down
+}
+
+// effectiveHitRatio returns the hit ratio for the current tick.
+// In write-around mode writes invalidate cached copies, so the share of
+// traffic that is writes is lost from the hit ratio.
+func (c *Cache) effectiveHitRatio(inRead, inWrite float64) float64 {
+	ratio := c.HitRatio * c.warmth
+	if c.WriteMode == "write-around" && inRead+inWrite > 0 {
+		ratio *= 1.0 - inWrite/(inRead+inWrite)
+	}
+	return math.Max(0, math.Min(1, ratio))
+}
+
+// Process serves hits locally and forwards misses and writes downstream.
+// If this node is DOWN, it is skipped entirely and its contents are lost.
+func (c *Cache) Process() {
+	if c.Down {
+		c.throughput = 0
+		c.utilization = 0
+		c.dropped = 0
+		c.hitRatio = 0
+		c.hits = 0
+		c.misses = 0
+		c.failIncoming()
+		return
+	}
+
+	inRead := c.IncomingRead
+	inWrite := c.IncomingWrite
+	inTotal := c.Incoming + inRead + inWrite
+	c.ResetIncoming()
+
+	// Proportional split if generic traffic exists
+	if inTotal > 0 && inRead == 0 && inWrite == 0 {
+		inRead = inTotal * defaultReadRatio
+		inWrite = inTotal * (1 - defaultReadRatio)
+	}
+
+	// Write-around bypasses the cache: writes go straight downstream and
+	// don't consume cache capacity. Write-through updates the cache as well.
+	cachedWrite := inWrite
+	bypassWrite := 0.0
+	if c.WriteMode == "write-around" {
+		cachedWrite = 0
+		bypassWrite = inWrite
+	}
+	cachedTotal := inRead + cachedWrite
+
+	dt := c.tickSeconds()
+	ratedRPS := c.derate(c.CapacityRPS)
+	capacity := sampleCapacity(c.random(), ratedRPS, c.ServiceCV, dt)
+	// Rates are per second; the queue holds requests.
+	queued := c.queueDepth / dt
+	totalArrival := cachedTotal + queued
+	processed := math.Min(totalArrival, capacity)
+
+	readTP, writeTP := 0.0, 0.0
+	if totalArrival > 0 {
+		ratio := processed / totalArrival
+		readTP = (inRead + (queued * (inRead / math.Max(1, cachedTotal)))) * ratio
+		writeTP = (cachedWrite + (queued * (cachedWrite / math.Max(1, cachedTotal)))) * ratio
+	}
+
+	c.classes.service = c.BaseLatency
+	c.localLatency = serverLatency(c.BaseLatency, c.ServiceCV, c.arrivalVar, c.queueDepth, cachedTotal, capacity, ratedRPS, dt)
+
+	c.queueDepth = math.Max(0.0, (totalArrival-processed)*dt)
+
+	// The queue holds at most 5 seconds of work.
+	maxQueue := c.CapacityRPS * 5.0
+	if c.queueDepth > maxQueue {
+		excess := c.queueDepth - maxQueue
+		c.dropped = excess / dt
+		c.totalDropped += excess
+		c.lost = c.dropped
+		c.queueDepth = maxQueue
+	} else {
+		c.dropped = 0
+	}
+
+	if ratedRPS > 0.0 {
+		c.utilization = math.Min(cachedTotal/ratedRPS, 1.0)
+		if c.queueDepth > 0 || processed < totalArrival-0.1 {
+			c.utilization = 1.0
+		}
+	}
+
+	c.hitRatio = c.effectiveHitRatio(inRead, inWrite)
+	c.hits = readTP * c.hitRatio
+	c.misses = readTP - c.hits
+	c.readTP = readTP
+	c.writeTP = writeTP + bypassWrite
+	c.throughput = c.readTP + c.writeTP
+	c.served = c.throughput
+
+	// Misses populate the cache; eviction removes a fixed share of entries
+	// every second.
+	if c.WarmupSeconds <= 0 {
+		c.warmth = 1.0
+	} else if readTP > 0 {
+		c.warmth = math.Min(1.0, c.warmth+dt/c.WarmupSeconds)
+	}
+	c.warmth *= math.Pow(1-c.EvictionRate, dt)
+
+	// Forward to healthy nodes only
+	downstream := c.Downstream()
+	var healthy []Node
+	for _, node := range downstream {
+		if !node.IsDown() {
+			healthy = append(healthy, node)
+		}
+	}
+	if len(healthy) == 0 {
+		// Hits are still served; misses and writes have nowhere to go.
+		c.unroutable(c.misses + c.writeTP)
+		return
+	}
+
+	var primaries []Node
+	for _, n := range healthy {
+		if db, ok := n.(*Database); ok {
+			if !db.IsReplica {
+				primaries = append(primaries, n)
+			}
+		} else {
+			primaries = append(primaries, n)
+		}
+	}
+
+	// Forward WRITEs to Primaries only (Discrete distribution)
+	if c.writeTP > 0 {
+		targets := primaries
+		if len(targets) == 0 {
+			targets = healthy
+		}
+		totalWrites := int(math.Floor(c.writeTP + 0.5))
+		base := totalWrites / len(targets)
+		remainder := totalWrites % len(targets)
+
+		for i, node := range targets {
+			val := float64(base)
+			if i < remainder {
+				val += 1.0
+			}
+			c.forward(node, val, true)
+		}
+	}
+
+	// Forward read MISSes to ALL healthy nodes (Discrete distribution)
+	if c.misses > 0 {
+		totalMisses := int(math.Floor(c.misses + 0.5))
+		base := totalMisses / len(healthy)
+		remainder := totalMisses % len(healthy)
+
+		for i, node := range healthy {
+			val := float64(base)
+			if i < remainder {
+				val += 1.0
+			}
+			c.forward(node, val, false)
+		}
+	}
+}
+
+func (c *Cache) CurrentLatency() float64 {
+	downstreamLatency := 0.0
+	downstream := c.Downstream()
+	if len(downstream) > 0 {
+		sum := 0.0
+		for _, node := range downstream {
+			sum += latencyOf(node)
+		}
+		downstreamLatency = sum / float64(len(downstream))
+	}
+	queueDelay := 0.0
+	if rated := c.derate(c.CapacityRPS); rated > 0 {
+		queueDelay = (c.queueDepth / rated) * 1000.0
+	}
+	// Only misses pay the downstream round trip.
+	return c.BaseLatency + queueDelay + (1.0-c.hitRatio)*downstreamLatency
+}
+
+func (c *Cache) GetMetrics() NodeMetrics {
+	return NodeMetrics{
+		ID:              c.NodeID,
+		Type:            c.NodeType,
+		Label:           c.NodeLabel,
+		Utilization:     c.utilization,
+		Latency:         latencyOf(c),
+		QueueDepth:      c.queueDepth,
+		ReadThroughput:  c.readTP,
+		WriteThroughput: c.writeTP,
+		Throughput:      c.throughput,
+		Dropped:         c.totalDropped,
+		DropRate:        c.dropped,
+		Status:          StatusFromUtilization(c.utilization, c.queueDepth, c.Down),
+		ArrivalRead:     c.lastArrivalR,
+		ArrivalWrite:    c.lastArrivalW,
+		ArrivalTotal:    c.lastArrivalT,
+		HitRatio:        c.hitRatio,
+		CacheHits:       c.hits,
+		CacheMisses:     c.misses,
+	}
+}
+
+func (c *Cache) MaxRPS() float64 {
+	return c.CapacityRPS
+}
+
+func (c *Cache) ResetQueues() {
+	c.queueDepth = 0
+	c.throughput = 0
+}
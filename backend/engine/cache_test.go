@@ -0,0 +1,92 @@
+package engine
+
+import "testing"
+
+// cached is client c (70% reads) -> cache -> database db, with a cache that
+// warms up over 10 seconds to an 80% hit ratio.
+func cached(configure func(*NodeConfig)) *ArchitectureConfig {
+	config := &ArchitectureConfig{
+		Seed: 1,
+		Nodes: []NodeConfig{
+			{ID: "c", Type: "client", RPS: 100, ReadRatio: 0.7},
+			{ID: "cache", Type: "cache", MaxRPS: 1000, HitRatio: 0.8, WarmupSeconds: 10},
+			{ID: "db", Type: "database", MaxRPS: 1000, ConcurrencyLimit: 1000},
+		},
+		Edges: []EdgeConfig{{Source: "c", Target: "cache"}, {Source: "cache", Target: "db"}},
+	}
+	if configure != nil {
+		setNode(config, "cache", configure)
+	}
+	return config
+}
+
+func TestCacheWarmsUp(t *testing.T) {
+	r := run(t, cached(nil), 20)
+	// The hit ratio climbs by a tenth of 0.8 every second until it's warm.
+	for _, tt := range []struct {
+		tick     int
+		hitRatio float64
+	}{{1, 0}, {2, 0.08}, {6, 0.4}, {11, 0.8}, {20, 0.8}} {
+		if got := nodeAt(t, r, tt.tick, "cache").HitRatio; !near(got, tt.hitRatio, 1e-9) {
+			t.Errorf("tick %d: hit ratio %v, want %v", tt.tick, got, tt.hitRatio)
+		}
+	}
+	// Warm, 56 of the 70 reads are hits; the rest and all writes reach db.
+	if got := nodeAt(t, r, 20, "db").Throughput; !near(got, 44, 1) {
+		t.Errorf("db served %v rps once the cache was warm, want 44", got)
+	}
+	if got := nodeAt(t, r, 1, "db").Throughput; !near(got, 100, 1e-9) {
+		t.Errorf("db served %v rps behind a cold cache, want all 100", got)
+	}
+}
+
+func TestCacheWriteModes(t *testing.T) {
+	tests := []struct {
+		mode     string
+		hitRatio float64
+		db       float64
+	}{
+		{"write-through", 0.8, 44},
+		// Writes (30% of traffic) invalidate what they touch.
+		{"write-around", 0.8 * 0.7, 61},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			r := run(t, cached(func(nc *NodeConfig) { nc.WriteMode = tt.mode }), 20)
+			cache := nodeAt(t, r, 20, "cache")
+			if !near(cache.HitRatio, tt.hitRatio, 1e-9) {
+				t.Errorf("hit ratio %v, want %v", cache.HitRatio, tt.hitRatio)
+			}
+			if db := nodeAt(t, r, 20, "db").Throughput; !near(db, tt.db, 1) {
+				t.Errorf("db served %v rps, want %v", db, tt.db)
+			}
+			if r.Summary.SuccessRate != 1 {
+				t.Errorf("success rate %v, want 1", r.Summary.SuccessRate)
+			}
+		})
+	}
+}
+
+// Evicting a tenth of the entries every second holds the cache at 90% warm.
+func TestCacheEviction(t *testing.T) {
+	r := run(t, cached(func(nc *NodeConfig) { nc.EvictionRate = 0.1 }), 120)
+	if got := nodeAt(t, r, 120, "cache").HitRatio; !near(got, 0.72, 0.001) {
+		t.Errorf("hit ratio %v, want 0.72", got)
+	}
+}
+
+// A cache that went DOWN lost its contents and comes back cold.
+func TestCacheComesBackCold(t *testing.T) {
+	config := cached(nil)
+	config.Chaos = &ChaosPlan{Events: []ChaosEvent{{At: 21, Action: "down", Node: "cache", Duration: 5}}}
+	r := run(t, config, 30)
+	if got := nodeAt(t, r, 20, "cache").HitRatio; !near(got, 0.8, 1e-9) {
+		t.Fatalf("hit ratio %v before the outage, want 0.8", got)
+	}
+	if got := nodeAt(t, r, 26, "cache").HitRatio; got != 0 {
+		t.Errorf("hit ratio %v right after coming back, want 0", got)
+	}
+	if got := nodeAt(t, r, 30, "cache").HitRatio; !near(got, 0.32, 1e-9) {
+		t.Errorf("hit ratio %v four seconds later, want 0.32", got)
+	}
+}
@@ -0,0 +1,217 @@
+package engine
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// ChaosPlan is a schedule of faults injected into a running simulation.
+type ChaosPlan struct {
+	Events []ChaosEvent `json:"events"`
+}
+
+// ChaosEvent is one scheduled fault. It fires once at tick At, counted from
+// when the plan was attached (the first tick after is tick 1; for a plan in
+// the architecture file that matches TickResult.Tick), or, with Probability
+// set, on every tick with that chance. Actions:
+//   - "down", "up": take Node down or bring it back.
+//   - "capacity": cut Node's capacity by Percent (0 restores it).
+//   - "latency": add LatencyMs to every request Node serves (0 removes it).
+//   - "degrade", "recover": put Node into Degradation or restore it.
+//   - "partition", "heal": cut or restore the edge Source -> Target. Requests
+//     sent over a cut edge are lost; the sender doesn't notice.
+//
+// With Duration set, the fault is undone that many ticks later, and a random
+// event doesn't fire again until then.
+type ChaosEvent struct {
+	At          int     `json:"at,omitempty"`
+	Probability float64 `json:"probability,omitempty"` // chance per tick (0 = fire at At)
+	Action      string  `json:"action"`
+	Node        string  `json:"node,omitempty"`
+	Source      string  `json:"source,omitempty"`
+	Target      string  `json:"target,omitempty"`
+	Percent     float64 `json:"percent,omitempty"`
+	LatencyMs   float64 `json:"latencyMs,omitempty"`
+	Duration    int     `json:"duration,omitempty"` // ticks until undone (0 = stays)
+
+	Degradation *Degradation `json:"degradation,omitempty"` // for "degrade"
+}
+
+// check verifies the plan against the graph it will run on.
+func (p *ChaosPlan) check(nodes map[string]Node) error {
+	for i, e := range p.Events {
+		if e.At < 0 || e.Duration < 0 {
+			return fmt.Errorf("event %d: at and duration must not be negative", i)
+		}
+		if e.Probability < 0 || e.Probability > 1 {
+			return fmt.Errorf("event %d: probability must be between 0 and 1", i)
+		}
+		if e.Probability == 0 && e.At == 0 {
+			return fmt.Errorf("event %d: needs a tick (at >= 1) or a probability", i)
+		}
+		switch e.Action {
+		case "degrade", "recover":
+			if _, ok := nodes[e.Node]; !ok {
+				return fmt.Errorf("event %d: unknown node %q", i, e.Node)
+			}
+			if e.Action == "degrade" {
+				if e.Degradation == nil {
+					return fmt.Errorf("event %d: degrade needs a degradation", i)
+				}
+				if err := e.Degradation.check(); err != nil {
+					return fmt.Errorf("event %d: %w", i, err)
+				}
+			}
+		case "down", "up", "capacity", "latency":
+			if _, ok := nodes[e.Node]; !ok {
+				return fmt.Errorf("event %d: unknown node %q", i, e.Node)
+			}
+			if e.Percent < 0 || e.Percent > 100 {
+				return fmt.Errorf("event %d: percent must be between 0 and 100", i)
+			}
+			if e.LatencyMs < 0 {
+				return fmt.Errorf("event %d: latencyMs must not be negative", i)
+			}
+		case "partition", "heal":
+			src, ok := nodes[e.Source]
+			if !ok {
+				return fmt.Errorf("event %d: unknown source %q", i, e.Source)
+			}
+			linked := false
+			for _, n := range src.Downstream() {
+				linked = linked || n.ID() == e.Target
+			}
+			if !linked {
+				return fmt.Errorf("event %d: no edge %s -> %s", i, e.Source, e.Target)
+			}
+		default:
+			return fmt.Errorf("event %d: unknown action %q", i, e.Action)
+		}
+	}
+	return nil
+}
+
+// undo returns the event that reverts e.
+func (e ChaosEvent) undo() ChaosEvent {
+	r := e
+	switch e.Action {
+	case "down":
+		r.Action = "up"
+	case "up":
+		r.Action = "down"
+	case "capacity":
+		r.Percent = 0
+	case "latency":
+		r.LatencyMs = 0
+	case "partition":
+		r.Action = "heal"
+	case "heal":
+		r.Action = "partition"
+	case "degrade":
+		r.Action = "recover"
+	}
+	return r
+}
+
+// chaosRun tracks a plan while it plays out.
+type chaosRun struct {
+	plan    *ChaosPlan
+	start   int // simulator tick count when the plan was attached
+	rng     *rand.Rand
+	reverts map[int][]int // tick -> indexes of events to undo
+	active  map[int]bool  // events waiting to be undone
+}
+
+func newChaosRun(plan *ChaosPlan, start int, seed int64) *chaosRun {
+	return &chaosRun{
+		plan:    plan,
+		start:   start,
+		rng:     rand.New(rand.NewSource(seed ^ int64(hashKey("chaos")))),
+		reverts: make(map[int][]int),
+		active:  make(map[int]bool),
+	}
+}
+
+// apply fires the events due on tick (the simulator's tick count) against
+// the graph, undoing expired ones first.
+func (c *chaosRun) apply(graph *Graph, tick int) {
+	due := c.reverts[tick]
+	delete(c.reverts, tick)
+	sort.Ints(due)
+	for _, i := range due {
+		delete(c.active, i)
+		applyChaos(graph, c.plan.Events[i].undo())
+	}
+
+	at := tick - c.start
+	for i, e := range c.plan.Events {
+		if e.Probability > 0 {
+			// Draw every tick so the sequence doesn't depend on what fired.
+			if c.rng.Float64() >= e.Probability || c.active[i] {
+				continue
+			}
+		} else if e.At != at {
+			continue
+		}
+		applyChaos(graph, e)
+		if e.Duration > 0 {
+			c.active[i] = true
+			c.reverts[tick+e.Duration] = append(c.reverts[tick+e.Duration], i)
+		}
+	}
+}
+
+// applyChaos performs one event and reports it on the affected node. Events
+// naming nodes that are no longer in the graph are skipped.
+func applyChaos(graph *Graph, e ChaosEvent) {
+	if e.Action == "partition" || e.Action == "heal" {
+		src, ok := graph.Nodes[e.Source]
+		if !ok {
+			return
+		}
+		cut := e.Action == "partition"
+		b := baseOf(src)
+		b.partition(e.Target, cut)
+		msg := fmt.Sprintf("edge %s -> %s restored", e.Source, e.Target)
+		if cut {
+			msg = fmt.Sprintf("edge %s -> %s cut", e.Source, e.Target)
+		}
+		b.emit("chaos-"+e.Action, msg)
+		return
+	}
+
+	node, ok := graph.Nodes[e.Node]
+	if !ok {
+		return
+	}
+	b := baseOf(node)
+	var msg string
+	switch e.Action {
+	case "down":
+		node.SetDown(true)
+		msg = "node taken down"
+	case "up":
+		node.SetDown(false)
+		msg = "node back up"
+	case "capacity":
+		b.capacityLoss = e.Percent / 100
+		msg = fmt.Sprintf("capacity cut by %.0f%%", e.Percent)
+		if e.Percent == 0 {
+			msg = "capacity restored"
+		}
+	case "degrade":
+		b.Degraded = e.Degradation
+		msg = "node degraded: " + e.Degradation.describe()
+	case "recover":
+		b.Degraded = nil
+		msg = "node recovered"
+	case "latency":
+		b.addedLatency = e.LatencyMs
+		msg = fmt.Sprintf("%.0fms latency injected", e.LatencyMs)
+		if e.LatencyMs == 0 {
+			msg = "injected latency removed"
+		}
+	}
+	b.emit("chaos-"+e.Action, msg)
+}
@@ -0,0 +1,142 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// chaosEvents returns the chaos events of a run as "action@tick".
+func chaosEvents(r *RunResult) []string {
+	var got []string
+	for _, tr := range r.Ticks {
+		for _, e := range tr.Events {
+			if strings.HasPrefix(e.Type, "chaos-") {
+				got = append(got, fmt.Sprintf("%s@%d", strings.TrimPrefix(e.Type, "chaos-"), e.Tick))
+			}
+		}
+	}
+	return got
+}
+
+// successRates returns the end-to-end success rate of every tick.
+func successRates(r *RunResult) []float64 {
+	var got []float64
+	for _, tr := range r.Ticks {
+		got = append(got, tr.SuccessRate)
+	}
+	return got
+}
+
+func TestChaosActions(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   ChaosEvent
+		events  []string
+		success []float64 // per tick
+	}{
+		{
+			name:    "down for three ticks",
+			event:   ChaosEvent{At: 2, Action: "down", Node: "db", Duration: 3},
+			events:  []string{"down@2", "up@5"},
+			success: []float64{1, 0, 0, 0, 1, 1},
+		},
+		{
+			name:    "partition",
+			event:   ChaosEvent{At: 3, Action: "partition", Source: "api", Target: "db", Duration: 2},
+			events:  []string{"partition@3", "heal@5"},
+			success: []float64{1, 1, 0, 0, 1, 1},
+		},
+		{
+			name:    "latency leaves requests succeeding",
+			event:   ChaosEvent{At: 2, Action: "latency", Node: "db", LatencyMs: 500},
+			events:  []string{"latency@2"},
+			success: []float64{1, 1, 1, 1, 1, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := chain(100)
+			config.Chaos = &ChaosPlan{Events: []ChaosEvent{tt.event}}
+			r := run(t, config, len(tt.success))
+			if got := chaosEvents(r); !reflect.DeepEqual(got, tt.events) {
+				t.Errorf("events %v, want %v", got, tt.events)
+			}
+			if got := successRates(r); !equalRates(got, tt.success) {
+				t.Errorf("success rates %v, want %v", got, tt.success)
+			}
+		})
+	}
+}
+
+func TestChaosCapacity(t *testing.T) {
+	config := chain(80)
+	setNode(config, "db", func(nc *NodeConfig) { nc.MaxRPS = 100 })
+	config.Chaos = &ChaosPlan{Events: []ChaosEvent{{At: 3, Action: "capacity", Node: "db", Percent: 50, Duration: 3}}}
+	r := run(t, config, 12)
+	if db := nodeAt(t, r, 2, "db"); db.Throughput != 80 || db.QueueDepth != 0 {
+		t.Errorf("before: db served %v with %v queued, want 80 and none", db.Throughput, db.QueueDepth)
+	}
+	if db := nodeAt(t, r, 5, "db"); db.Throughput != 50 || db.QueueDepth != 90 {
+		t.Errorf("cut: db served %v with %v queued, want 50 and 90", db.Throughput, db.QueueDepth)
+	}
+	// Restored, the 20 rps to spare work the backlog off in five seconds.
+	if db := nodeAt(t, r, 11, "db"); db.QueueDepth != 0 || db.Throughput != 80 {
+		t.Errorf("after: db served %v with %v queued, want 80 and none", db.Throughput, db.QueueDepth)
+	}
+}
+
+// Random events come from the run's seed: the same seed gives the same
+// faults, and a fault doesn't fire again while it's still in place.
+func TestChaosProbability(t *testing.T) {
+	plan := func() *ChaosPlan {
+		return &ChaosPlan{Events: []ChaosEvent{{Probability: 0.3, Action: "down", Node: "db", Duration: 2}}}
+	}
+	runSeed := func(seed int64) []string {
+		config := chain(100)
+		config.Seed = seed
+		config.Chaos = plan()
+		return chaosEvents(run(t, config, 50))
+	}
+	first, again, other := runSeed(1), runSeed(1), runSeed(2)
+	if len(first) == 0 || !reflect.DeepEqual(first, again) {
+		t.Fatalf("seed 1 gave %v, then %v", first, again)
+	}
+	if reflect.DeepEqual(first, other) {
+		t.Errorf("seeds 1 and 2 both gave %v", first)
+	}
+	for i, e := range first {
+		want := "down@"
+		if i%2 == 1 {
+			want = "up@"
+		}
+		if !strings.HasPrefix(e, want) {
+			t.Fatalf("events %v, want downs and ups taking turns", first)
+		}
+	}
+}
+
+func TestChaosPlanIsChecked(t *testing.T) {
+	tests := []struct {
+		name  string
+		event ChaosEvent
+		err   string
+	}{
+		{"no tick", ChaosEvent{Action: "down", Node: "db"}, "needs a tick"},
+		{"unknown node", ChaosEvent{At: 1, Action: "down", Node: "cache"}, `unknown node "cache"`},
+		{"no such edge", ChaosEvent{At: 1, Action: "partition", Source: "db", Target: "api"}, "no edge db -> api"},
+		{"percent", ChaosEvent{At: 1, Action: "capacity", Node: "db", Percent: 150}, "percent"},
+		{"degrade without degradation", ChaosEvent{At: 1, Action: "degrade", Node: "db"}, "needs a degradation"},
+		{"unknown action", ChaosEvent{At: 1, Action: "explode", Node: "db"}, "unknown action"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := chain(100)
+			config.Chaos = &ChaosPlan{Events: []ChaosEvent{tt.event}}
+			if _, err := BuildGraphFromConfig(config); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
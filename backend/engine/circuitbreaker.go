@@ -0,0 +1,216 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+)
+
+// Circuit breaker states.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// CircuitBreaker sits in front of a downstream service and stops sending it
+// traffic once it is failing. While CLOSED everything passes through and the
+// downstream failure rate and p99 latency are watched; crossing a threshold
+// trips the breaker OPEN, which fails every request fast. After OpenSeconds the
+// breaker goes HALF-OPEN and lets ProbeRatio of the traffic through: healthy
+// probes close it again, failing probes re-open it.
+type CircuitBreaker struct {
+	BaseNode
+	ErrorThreshold     float64 // downstream fail rate that trips the breaker (0.0 to 1.0; 0 = any failure)
+	LatencyThresholdMs float64 // downstream p99 latency that trips the breaker (0 = ignore latency)
+	OpenSeconds        float64 // simulated seconds to stay OPEN before probing
+	ProbeRatio         float64 // share of traffic let through while HALF-OPEN
+	MinRequests        float64 // minimum requests per tick before the breaker judges health
+
+	State      string
+	openedAt   int
+	tick       int
+	throughput float64
+	readTP     float64
+	writeTP    float64
+	rejected   float64
+}
+
+// NewCircuitBreaker creates a new, closed CircuitBreaker node.
+func NewCircuitBreaker(id, label string) *CircuitBreaker {
+	return &CircuitBreaker{
+		BaseNode: BaseNode{
+			NodeID:    id,
+			NodeType:  "circuitbreaker",
+			NodeLabel: label,
+		},
+		ErrorThreshold: 0.5,
+		OpenSeconds:    5,
+		ProbeRatio:     0.1,
+		MinRequests:    10,
+		State:          BreakerClosed,
+	}
+}
+
+// Process passes traffic downstream according to the breaker state and fails
+// the rest fast.
+func (cb *CircuitBreaker) Process() {
+	cb.tick++
+	if cb.Down {
+		cb.throughput = 0
+		cb.rejected = 0
+		cb.failIncoming()
+		return
+	}
+
+	inRead := cb.IncomingRead
+	inWrite := cb.IncomingWrite
+	inTotal := cb.Incoming + inRead + inWrite
+	cb.ResetIncoming()
+
+	// Proportional split if generic traffic exists
+	if inTotal > 0 && inRead == 0 && inWrite == 0 {
+		inRead = inTotal * defaultReadRatio
+		inWrite = inTotal * (1 - defaultReadRatio)
+	}
+
+	openTicks := int(math.Max(1, float64(ticksFor(cb.OpenSeconds, cb.tickSeconds()))))
+	if cb.State == BreakerOpen && cb.tick-cb.openedAt >= openTicks {
+		cb.transition(BreakerHalfOpen, "probing downstream")
+	}
+
+	pass := 1.0
+	switch cb.State {
+	case BreakerOpen:
+		pass = 0
+	case BreakerHalfOpen:
+		pass = math.Max(0, math.Min(1, cb.ProbeRatio))
+	}
+
+	cb.readTP = inRead * pass
+	cb.writeTP = inWrite * pass
+	cb.throughput = cb.readTP + cb.writeTP
+	cb.rejected = inTotal - cb.throughput
+	cb.localLatency = PointLatency(0)
+	cb.served = cb.throughput
+	cb.lost = cb.rejected
+
+	healthy := cb.healthyDownstream()
+	if len(healthy) == 0 {
+		cb.unroutable(cb.throughput)
+		return
+	}
+	if cb.throughput == 0 {
+		return
+	}
+	writeTargets := primariesOf(healthy)
+	if len(writeTargets) == 0 {
+		writeTargets = healthy
+	}
+	cb.spread(cb.writeTP, writeTargets, true)
+	cb.spread(cb.readTP, healthy, false)
+}
+
+// Settle judges the downstream's health from the requests that passed
+// through this tick and moves the breaker between states.
+func (cb *CircuitBreaker) Settle() {
+	cb.BaseNode.Settle()
+
+	var forwarded float64
+	for _, v := range cb.sent {
+		forwarded += v
+	}
+	// Requests let through with nowhere to go (every downstream DOWN or cut
+	// off) were attempted too, and failed.
+	var unrouted float64
+	if !cb.Down {
+		unrouted = math.Max(0, cb.lost-cb.rejected)
+	}
+	attempted := forwarded + unrouted
+	if cb.State == BreakerOpen || attempted <= 0 {
+		return
+	}
+	// Probes are few by design, so don't demand MinRequests while HALF-OPEN.
+	if cb.State == BreakerClosed && attempted*cb.tickSeconds() < cb.MinRequests {
+		return
+	}
+
+	failRate := math.Min(1, (cb.downFailed+cb.timedOut+unrouted)/attempted)
+	p99 := cb.latency.Quantile(0.99)
+	tripped := failRate > 0 && failRate >= cb.ErrorThreshold
+	slow := cb.LatencyThresholdMs > 0 && p99 >= cb.LatencyThresholdMs
+
+	switch {
+	case tripped || slow:
+		reason := fmt.Sprintf("downstream failing %.0f%%", failRate*100)
+		if !tripped {
+			reason = fmt.Sprintf("downstream p99 %.0fms", p99)
+		}
+		if cb.State == BreakerHalfOpen {
+			reason = "probe failed: " + reason
+		}
+		cb.transition(BreakerOpen, reason)
+		cb.openedAt = cb.tick
+	case cb.State == BreakerHalfOpen:
+		cb.transition(BreakerClosed, "probes succeeded")
+	}
+}
+
+// transition moves the breaker to a new state and reports it.
+func (cb *CircuitBreaker) transition(state, reason string) {
+	if cb.State == state {
+		return
+	}
+	cb.emit("breaker-"+state, fmt.Sprintf("%s -> %s (%s)", cb.State, state, reason))
+	cb.State = state
+}
+
+func (cb *CircuitBreaker) fillMetrics(m *NodeMetrics) {
+	cb.BaseNode.fillMetrics(m)
+	m.Rejected = cb.rejected
+	m.BreakerState = cb.State
+}
+
+func (cb *CircuitBreaker) GetMetrics() NodeMetrics {
+	status := StatusFromUtilization(0, 0, cb.Down)
+	if cb.State != BreakerClosed && !cb.Down {
+		status = "overloaded"
+	}
+	return NodeMetrics{
+		ID:              cb.NodeID,
+		Type:            cb.NodeType,
+		Label:           cb.NodeLabel,
+		Latency:         latencyOf(cb),
+		ReadThroughput:  cb.readTP,
+		WriteThroughput: cb.writeTP,
+		Throughput:      cb.throughput,
+		Status:          status,
+		ArrivalRead:     cb.lastArrivalR,
+		ArrivalWrite:    cb.lastArrivalW,
+		ArrivalTotal:    cb.lastArrivalT,
+	}
+}
+
+func (cb *CircuitBreaker) MaxRPS() float64 {
+	return 0
+}
+
+func (cb *CircuitBreaker) CurrentLatency() float64 {
+	if cb.State == BreakerOpen {
+		return 0
+	}
+	downstream := cb.Downstream()
+	if len(downstream) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, node := range downstream {
+		sum += latencyOf(node)
+	}
+	return sum / float64(len(downstream))
+}
+
+// ResetQueues closes the breaker.
+func (cb *CircuitBreaker) ResetQueues() {
+	cb.transition(BreakerClosed, "reset")
+	cb.throughput = 0
+}
@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// breakerChain is client c -> circuitbreaker cb -> appserver a -> database db.
+func breakerChain() *ArchitectureConfig {
+	return &ArchitectureConfig{
+		Seed: 1,
+		Nodes: []NodeConfig{
+			{ID: "c", Type: "client", RPS: 100},
+			{ID: "cb", Type: "circuitbreaker"},
+			{ID: "a", Type: "appserver", MaxRPS: 1000, BaseLatency: 20, ConcurrencyLimit: 1000},
+			{ID: "db", Type: "database", MaxRPS: 1000, BaseLatency: 10, ConcurrencyLimit: 1000},
+		},
+		Edges: []EdgeConfig{{Source: "c", Target: "cb"}, {Source: "cb", Target: "a"}, {Source: "a", Target: "db"}},
+	}
+}
+
+// breakerEvents lists cb's state changes over a run as "state@tick".
+func breakerEvents(r *RunResult) []string {
+	var got []string
+	for _, tr := range r.Ticks {
+		for _, e := range tr.Events {
+			if e.NodeID == "cb" && strings.HasPrefix(e.Type, "breaker-") {
+				got = append(got, fmt.Sprintf("%s@%d", strings.TrimPrefix(e.Type, "breaker-"), e.Tick))
+			}
+		}
+	}
+	return got
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	zero := 0.0
+	tests := []struct {
+		name   string
+		set    func(nc *NodeConfig) // breaker settings
+		chaos  []ChaosEvent
+		events []string
+	}{
+		{
+			name:   "healthy downstream stays closed",
+			events: nil,
+		},
+		{
+			name:   "downstream DOWN opens it and probes keep failing",
+			chaos:  []ChaosEvent{{At: 5, Action: "down", Node: "a"}},
+			events: []string{"open@5", "half-open@10", "open@10", "half-open@15", "open@15", "half-open@20", "open@20"},
+		},
+		{
+			name:   "brownout opens it until probes succeed",
+			chaos:  []ChaosEvent{{At: 5, Action: "degrade", Node: "a", Duration: 8, Degradation: &Degradation{ErrorRate: 0.9}}},
+			events: []string{"open@5", "half-open@10", "open@10", "half-open@15", "closed@15"},
+		},
+		{
+			name:   "errors below the threshold don't trip it",
+			chaos:  []ChaosEvent{{At: 5, Action: "degrade", Node: "a", Degradation: &Degradation{ErrorRate: 0.2}}},
+			events: nil,
+		},
+		{
+			name:   "threshold 0 trips on any failure",
+			set:    func(nc *NodeConfig) { nc.ErrorThreshold = &zero },
+			chaos:  []ChaosEvent{{At: 5, Action: "degrade", Node: "a", Degradation: &Degradation{ErrorRate: 0.01}}},
+			events: []string{"open@5", "half-open@10", "open@10", "half-open@15", "open@15", "half-open@20", "open@20"},
+		},
+		{
+			name:   "slow downstream trips the latency threshold",
+			set:    func(nc *NodeConfig) { nc.LatencyThresholdMs = 100 },
+			chaos:  []ChaosEvent{{At: 5, Action: "latency", Node: "db", LatencyMs: 200, Duration: 3}},
+			events: []string{"open@5", "half-open@10", "closed@10"},
+		},
+		{
+			name:   "open window in seconds",
+			set:    func(nc *NodeConfig) { nc.OpenSeconds = 2 },
+			chaos:  []ChaosEvent{{At: 5, Action: "down", Node: "a", Duration: 4}},
+			events: []string{"open@5", "half-open@7", "open@7", "half-open@9", "closed@9"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := breakerChain()
+			if tt.set != nil {
+				setNode(config, "cb", tt.set)
+			}
+			if tt.chaos != nil {
+				config.Chaos = &ChaosPlan{Events: tt.chaos}
+			}
+			r := run(t, config, 20)
+			if got := breakerEvents(r); !reflect.DeepEqual(got, tt.events) {
+				t.Errorf("breaker went %v, want %v", got, tt.events)
+			}
+		})
+	}
+}
+
+// While open, the breaker fails requests fast instead of sending them on.
+func TestCircuitBreakerFailsFastWhileOpen(t *testing.T) {
+	config := breakerChain()
+	config.Chaos = &ChaosPlan{Events: []ChaosEvent{{At: 5, Action: "down", Node: "a"}}}
+	r := run(t, config, 8)
+	cb := nodeAt(t, r, 7, "cb")
+	if cb.BreakerState != BreakerOpen || cb.Rejected != 100 || cb.Throughput != 0 {
+		t.Errorf("tick 7: state %s, rejected %v, passed %v; want open, 100 and 0", cb.BreakerState, cb.Rejected, cb.Throughput)
+	}
+}
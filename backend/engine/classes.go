@@ -0,0 +1,630 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// RequestClass is a named kind of request a client sends, e.g. "search" or
+// "checkout". Classes travel with the traffic through every node: each node
+// reports arrivals and throughput per class, a request of the class uses
+// Cost times the capacity of an ordinary one at each node, and Route can
+// steer the class to particular downstream nodes. A class may be sent by
+// several clients; its cost, routes and SLOs must then be the same on all.
+type RequestClass struct {
+	Name      string              `json:"name"`
+	Share     float64             `json:"share"`               // of the client's traffic, relative to its other classes
+	ReadRatio *float64            `json:"readRatio,omitempty"` // unset = the client's; 0 = writes only
+	Cost      map[string]float64  `json:"cost,omitempty"`      // node ID or type -> capacity used per request (default 1)
+	Route     map[string][]string `json:"route,omitempty"`     // node ID -> downstream nodes the class goes to from there
+	SLOs      []string            `json:"slos,omitempty"`      // checked by headless runs, e.g. "p99 <= 300"
+}
+
+// costAt returns the capacity one request of the class uses at a node.
+func (rc *RequestClass) costAt(id, nodeType string) float64 {
+	if c, ok := rc.Cost[id]; ok {
+		return c
+	}
+	if c, ok := rc.Cost[nodeType]; ok {
+		return c
+	}
+	return 1
+}
+
+// classSet is every request class of a graph.
+type classSet struct {
+	byName map[string]*RequestClass
+	names  []string // sorted
+}
+
+// buildClasses checks the classes defined on clients, normalizes each
+// client's shares and read ratios, and returns the graph's class set (nil if
+// no client defines classes). Edges must be wired already.
+func buildClasses(configs []NodeConfig, nodes map[string]Node) (*classSet, error) {
+	set := &classSet{byName: make(map[string]*RequestClass)}
+	definedOn := make(map[string]string)
+	for _, nc := range configs {
+		if len(nc.Classes) == 0 {
+			continue
+		}
+		client, ok := nodes[nc.ID].(*Client)
+		if !ok {
+			return nil, fmt.Errorf("node %s: only clients define request classes", nc.ID)
+		}
+		var total float64
+		seen := make(map[string]bool)
+		for _, rc := range nc.Classes {
+			if rc.Name == "" {
+				return nil, fmt.Errorf("client %s: request class without a name", nc.ID)
+			}
+			if seen[rc.Name] {
+				return nil, fmt.Errorf("client %s: class %q defined twice", nc.ID, rc.Name)
+			}
+			seen[rc.Name] = true
+			if _, ok := nodes[rc.Name]; ok {
+				return nil, fmt.Errorf("class %q has the same name as a node", rc.Name)
+			}
+			if err := rc.check(nodes); err != nil {
+				return nil, fmt.Errorf("class %q: %w", rc.Name, err)
+			}
+			if prev, ok := set.byName[rc.Name]; ok {
+				if !reflect.DeepEqual(prev.Cost, rc.Cost) || !reflect.DeepEqual(prev.Route, rc.Route) || !reflect.DeepEqual(prev.SLOs, rc.SLOs) {
+					return nil, fmt.Errorf("class %q is defined differently on %s and %s", rc.Name, definedOn[rc.Name], nc.ID)
+				}
+			} else {
+				def := rc
+				set.byName[rc.Name] = &def
+				set.names = append(set.names, rc.Name)
+				definedOn[rc.Name] = nc.ID
+			}
+			total += rc.Share
+		}
+
+		client.Classes = make([]RequestClass, len(nc.Classes))
+		for i, rc := range nc.Classes {
+			rc.Share /= total
+			if rc.ReadRatio == nil {
+				r := client.ReadRatio
+				rc.ReadRatio = &r
+			}
+			client.Classes[i] = rc
+		}
+	}
+	if len(set.names) == 0 {
+		return nil, nil
+	}
+	sort.Strings(set.names)
+	return set, nil
+}
+
+// check verifies one class definition against the graph.
+func (rc *RequestClass) check(nodes map[string]Node) error {
+	if rc.Share <= 0 {
+		return fmt.Errorf("share must be positive")
+	}
+	if r := rc.ReadRatio; r != nil && (*r < 0 || *r > 1) {
+		return fmt.Errorf("readRatio must be between 0 and 1")
+	}
+	for key, c := range rc.Cost {
+		if _, ok := nodes[key]; !ok && !nodeTypes[key] {
+			return fmt.Errorf("cost for unknown node or node type %q", key)
+		}
+		if c <= 0 {
+			return fmt.Errorf("cost at %s must be positive", key)
+		}
+	}
+	for at, targets := range rc.Route {
+		n, ok := nodes[at]
+		if !ok {
+			return fmt.Errorf("route from unknown node %q", at)
+		}
+		for _, t := range targets {
+			linked := false
+			for _, d := range n.Downstream() {
+				linked = linked || d.ID() == t
+			}
+			if !linked {
+				return fmt.Errorf("route %s -> %s is not an edge", at, t)
+			}
+		}
+	}
+	for _, expr := range rc.SLOs {
+		slo, err := ParseSLO(expr)
+		if err != nil {
+			return err
+		}
+		if slo.Node != "" {
+			return fmt.Errorf("slo %q: class SLOs apply to the class, not a node", expr)
+		}
+	}
+	return nil
+}
+
+// SLOExprs returns the SLO expressions of a run: SLOs, then every request
+// class's, scoped to the class (e.g. "checkout.p99 <= 300").
+func (c *ArchitectureConfig) SLOExprs() []string {
+	exprs := append([]string(nil), c.SLOs...)
+	seen := make(map[string]bool)
+	for _, nc := range c.Nodes {
+		for _, rc := range nc.Classes {
+			if seen[rc.Name] {
+				continue
+			}
+			seen[rc.Name] = true
+			for _, expr := range rc.SLOs {
+				exprs = append(exprs, rc.Name+"."+expr)
+			}
+		}
+	}
+	return exprs
+}
+
+// shareClasses hands the graph's classes to every node.
+func (g *Graph) shareClasses() {
+	for _, n := range g.Nodes {
+		baseOf(n).classes.defs = g.classes
+	}
+}
+
+// Directions of class traffic.
+const (
+	dirRead  = 0
+	dirWrite = 1
+)
+
+func direction(isWrite bool) int {
+	if isWrite {
+		return dirWrite
+	}
+	return dirRead
+}
+
+// classFlow is what a node knows about the request classes passing through
+// it. Mixes are shares of the node's arrivals; traffic sent without a class
+// makes up the rest.
+type classFlow struct {
+	defs     *classSet                     // nil without classes
+	in       [2]map[string]float64         // arrivals this tick by class, reads and writes
+	mix      [2]map[string]float64         // class shares of the reads and writes arriving here
+	sent     map[string]map[string]float64 // requests forwarded to each downstream node this tick, by class
+	detours  []detour                      // requests waiting to take their class's route
+	latency  map[string]LatencyDist        // end-to-end latency by class
+	failRate map[string]float64            // share failed end-to-end by class
+	cost     float64                       // capacity an average arriving request uses (0 = 1)
+	service  float64                       // ms an ordinary request takes to serve here (0 for routing nodes)
+}
+
+// detour is class traffic held back from a node its class doesn't route to.
+type detour struct {
+	class   string
+	isWrite bool
+	rps     float64
+	to      Node // where it was going
+}
+
+func (f *classFlow) enabled() bool {
+	return f.defs != nil
+}
+
+// receiveClasses records arriving class traffic.
+func (b *BaseNode) receiveClasses(byClass map[string]float64, isWrite bool) {
+	f := &b.classes
+	dir := direction(isWrite)
+	for c, v := range byClass {
+		if f.in[dir] == nil {
+			f.in[dir] = make(map[string]float64)
+		}
+		f.in[dir][c] += v
+	}
+}
+
+// rolloverClasses turns this tick's class arrivals into the mix the node
+// works with, once ResetIncoming has recorded the arrivals. With nothing
+// arriving in a direction the last mix stays, for queued work.
+func (b *BaseNode) rolloverClasses() {
+	f := &b.classes
+	for c := range f.sent {
+		delete(f.sent, c)
+	}
+	if !f.enabled() {
+		return
+	}
+	for dir, arrived := range [2]float64{b.lastArrivalR, b.lastArrivalW} {
+		if arrived > 0 {
+			mix := make(map[string]float64, len(f.in[dir]))
+			for c, v := range f.in[dir] {
+				mix[c] = math.Min(1, v/arrived)
+			}
+			f.mix[dir] = mix
+		}
+		f.in[dir] = nil
+	}
+	b.updateCost()
+}
+
+// setClassMix sets the mix directly, for clients, which create the traffic.
+func (b *BaseNode) setClassMix(read, write map[string]float64) {
+	b.classes.mix = [2]map[string]float64{read, write}
+	b.updateCost()
+}
+
+// updateCost recomputes the capacity an average arriving request uses.
+func (b *BaseNode) updateCost() {
+	f := &b.classes
+	reads, writes := b.lastArrivalR, b.lastArrivalW
+	if reads+writes <= 0 {
+		return
+	}
+	var cost float64
+	for dir, arrived := range [2]float64{reads, writes} {
+		tagged := 0.0
+		for _, c := range f.defs.names {
+			share := f.mix[dir][c]
+			tagged += share
+			cost += arrived * share * f.defs.byName[c].costAt(b.NodeID, b.NodeType)
+		}
+		cost += arrived * math.Max(0, 1-tagged)
+	}
+	f.cost = cost / (reads + writes)
+}
+
+// costFactor returns the capacity an average request uses here.
+func (b *BaseNode) costFactor() float64 {
+	if b.classes.cost <= 0 {
+		return 1
+	}
+	return b.classes.cost
+}
+
+// splitClasses divides requests about to be forwarded by class, following
+// the node's mix (nil without classes).
+func (b *BaseNode) splitClasses(rps float64, isWrite bool) map[string]float64 {
+	f := &b.classes
+	if !f.enabled() {
+		return nil
+	}
+	mix := f.mix[direction(isWrite)]
+	if len(mix) == 0 {
+		return nil
+	}
+	byClass := make(map[string]float64, len(mix))
+	for c, share := range mix {
+		byClass[c] = rps * share
+	}
+	return byClass
+}
+
+// route returns the downstream nodes class c goes to from this node (nil if
+// it goes wherever the node sends it).
+func (b *BaseNode) route(c string) []string {
+	if rc, ok := b.classes.defs.byName[c]; ok {
+		return rc.Route[b.NodeID]
+	}
+	return nil
+}
+
+// holdDetours takes the classes routed elsewhere out of d, to be sent on by
+// flushDetours.
+func (b *BaseNode) holdDetours(d *delivery) {
+	for _, c := range b.classes.defs.names {
+		v, ok := d.byClass[c]
+		route := b.route(c)
+		if !ok || len(route) == 0 || contains(route, d.to.ID()) {
+			continue
+		}
+		b.classes.detours = append(b.classes.detours, detour{c, d.isWrite, v, d.to})
+		d.rps -= v
+		delete(d.byClass, c)
+	}
+}
+
+// flushDetours sends held-back class traffic along its routes, evenly over
+// the route's nodes that are up and reachable. If none is, the traffic goes
+// where it was sent in the first place.
+func (b *BaseNode) flushDetours() {
+	detours := b.classes.detours
+	b.classes.detours = nil
+	type key struct {
+		class   string
+		isWrite bool
+	}
+	var keys []key
+	totals := make(map[key]float64)
+	for _, d := range detours {
+		k := key{d.class, d.isWrite}
+		if _, ok := totals[k]; !ok {
+			keys = append(keys, k)
+		}
+		totals[k] += d.rps
+	}
+
+	for _, k := range keys {
+		var targets []Node
+		for _, n := range b.DownstreamNodes {
+			if contains(b.route(k.class), n.ID()) && !n.IsDown() && b.reaches(n) {
+				targets = append(targets, n)
+			}
+		}
+		if len(targets) == 0 {
+			for _, d := range detours {
+				if d.class == k.class && d.isWrite == k.isWrite {
+					b.send(delivery{to: d.to, rps: d.rps, isWrite: d.isWrite, byClass: map[string]float64{d.class: d.rps}})
+				}
+			}
+			continue
+		}
+		each := totals[k] / float64(len(targets))
+		for _, n := range targets {
+			b.send(delivery{to: n, rps: each, isWrite: k.isWrite, byClass: map[string]float64{k.class: each}})
+		}
+	}
+}
+
+func contains(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// classShare returns the share of this tick's arrivals that belongs to c.
+func (b *BaseNode) classShare(c string) float64 {
+	arrived := b.lastArrivalR + b.lastArrivalW
+	if arrived <= 0 {
+		return 0
+	}
+	f := &b.classes
+	return (b.lastArrivalR*f.mix[dirRead][c] + b.lastArrivalW*f.mix[dirWrite][c]) / arrived
+}
+
+// downstreamParts returns the latency seen by the w requests sent to n, as
+// parts to mix, and how many of them failed. Request classes go by what n
+// reports for their class; the rest by n's overall figures.
+func (b *BaseNode) downstreamParts(n Node, w float64) (parts []LatencyDist, weights []float64, failed float64) {
+	add := func(d LatencyDist, v float64) {
+		if !d.Empty() {
+			parts = append(parts, d)
+			weights = append(weights, v)
+		}
+	}
+	rest := w
+	if b.classes.enabled() {
+		nf := &baseOf(n).classes
+		for _, c := range b.classes.defs.names {
+			v := b.classes.sent[n.ID()][c]
+			if v <= 0 {
+				continue
+			}
+			rest -= v
+			rate, ok := nf.failRate[c]
+			if !ok {
+				rate = failRateFrom(n, b.NodeID)
+			}
+			failed += v * rate
+			d, ok := nf.latency[c]
+			if !ok || d.Empty() {
+				d = n.LatencyDistribution()
+			}
+			add(d, v)
+		}
+	}
+	if rest > 1e-9 {
+		failed += rest * failRateFrom(n, b.NodeID)
+		add(n.LatencyDistribution(), rest)
+	}
+	return parts, weights, failed
+}
+
+// settleClasses works out end-to-end latency and failures per class, after
+// Settle, the same way Settle does for all traffic: local time plus the
+// class's latency at the nodes it was forwarded to. Classes share the wait in
+// the node's queue, but each takes its cost times the ordinary service time.
+// Local drops and errors are shared in proportion to the mix; whatever a
+// node's Settle does on top (retries) scales every class alike.
+func (b *BaseNode) settleClasses() {
+	f := &b.classes
+	if !f.enabled() {
+		return
+	}
+	f.latency = make(map[string]LatencyDist)
+	f.failRate = make(map[string]float64)
+	handled := b.served + b.lost
+	scale := 1.0
+	if raw := b.lost + b.errors + b.pathFailed(); raw > 0 {
+		scale = b.failed / raw
+	}
+
+	for _, c := range f.defs.names {
+		share := b.classShare(c)
+		if share <= 0 || handled <= 0 {
+			continue
+		}
+		served := b.served * share
+
+		var parts []LatencyDist
+		var weights []float64
+		var forwarded, downFailed float64
+		seen := make(map[string]bool)
+		for _, n := range b.DownstreamNodes {
+			w := f.sent[n.ID()][c]
+			if w <= 0 || seen[n.ID()] {
+				continue
+			}
+			seen[n.ID()] = true
+			nf := &baseOf(n).classes
+			rate, ok := nf.failRate[c]
+			if !ok {
+				rate = failRateFrom(n, b.NodeID)
+			}
+			downFailed += w * rate
+			d, ok := nf.latency[c]
+			if !ok || d.Empty() {
+				d = n.LatencyDistribution()
+			}
+			if d.Empty() {
+				continue
+			}
+			parts = append(parts, d)
+			weights = append(weights, w)
+			forwarded += w
+		}
+
+		var latency LatencyDist
+		var timedOut float64
+		if !b.localLatency.Empty() {
+			local := b.localLatency
+			if cost := f.defs.byName[c].costAt(b.NodeID, b.NodeType); f.service > 0 && cost != 1 {
+				local = local.plus(f.service * (cost - 1))
+			}
+			if rest := served - forwarded; rest > 0 || len(parts) == 0 {
+				parts = append(parts, PointLatency(0))
+				weights = append(weights, math.Max(rest, 1))
+			}
+			latency = local.Then(MixLatency(parts, weights))
+			if b.TimeoutMs > 0 {
+				timedOut = math.Max(0, served-downFailed) * latency.FractionAbove(b.TimeoutMs)
+				latency = latency.Clip(b.TimeoutMs)
+			}
+		}
+		failed := (b.lost+b.errors)*share + (downFailed+timedOut)*(1-b.errorRate())
+		f.latency[c] = latency
+		f.failRate[c] = math.Min(1, failed*scale/(handled*share))
+	}
+}
+
+// settleClasses gives every class the queue's own latency and failures:
+// producers don't wait for consumers.
+func (q *Queue) settleClasses() {
+	f := &q.classes
+	if !f.enabled() {
+		return
+	}
+	f.latency = make(map[string]LatencyDist)
+	f.failRate = make(map[string]float64)
+	for _, c := range f.defs.names {
+		if q.classShare(c) > 0 {
+			f.latency[c] = q.latency
+			f.failRate[c] = q.failRate
+		}
+	}
+}
+
+// fillClassMetrics adds per-class arrivals and throughput to m.
+func (b *BaseNode) fillClassMetrics(m *NodeMetrics) {
+	f := &b.classes
+	if !f.enabled() {
+		return
+	}
+	arrived := b.lastArrivalR + b.lastArrivalW
+	for _, c := range f.defs.names {
+		in := b.lastArrivalR*f.mix[dirRead][c] + b.lastArrivalW*f.mix[dirWrite][c]
+		if in <= 0 {
+			continue
+		}
+		var tp float64
+		if m.ReadThroughput+m.WriteThroughput > 0 {
+			tp = m.ReadThroughput*f.mix[dirRead][c] + m.WriteThroughput*f.mix[dirWrite][c]
+		} else if arrived > 0 {
+			tp = m.Throughput * in / arrived
+		}
+		if m.ClassArrivals == nil {
+			m.ClassArrivals = make(map[string]float64)
+			m.ClassThroughput = make(map[string]float64)
+		}
+		m.ClassArrivals[c] = in
+		m.ClassThroughput[c] = tp
+	}
+}
+
+// classMix returns the read and write mixes of the client's traffic, and the
+// read ratio the classes add up to.
+func (c *Client) classMix() (read, write map[string]float64, readRatio float64) {
+	for _, rc := range c.Classes {
+		readRatio += rc.Share * *rc.ReadRatio
+	}
+	read = make(map[string]float64, len(c.Classes))
+	write = make(map[string]float64, len(c.Classes))
+	for _, rc := range c.Classes {
+		if readRatio > 0 {
+			read[rc.Name] = rc.Share * *rc.ReadRatio / readRatio
+		}
+		if readRatio < 1 {
+			write[rc.Name] = rc.Share * (1 - *rc.ReadRatio) / (1 - readRatio)
+		}
+	}
+	return read, write, readRatio
+}
+
+// ClassMetrics is the end-to-end view of one request class, across every
+// client sending it.
+type ClassMetrics struct {
+	Name        string  `json:"name"`
+	InjectedRPS float64 `json:"injectedRPS"` // new requests per second
+	Succeeded   float64 `json:"succeeded"`
+	Failed      float64 `json:"failed"`
+	SuccessRate float64 `json:"successRate"`
+	LatencySummary
+}
+
+// classTotal adds up one class over the clients in a tick.
+type classTotal struct {
+	injected, succeeded, failed float64
+	latency                     LatencyDist
+	weight                      float64
+}
+
+// classTotals adds up every class of the graph over its clients.
+func (g *Graph) classTotals() map[string]*classTotal {
+	if g.classes == nil {
+		return nil
+	}
+	totals := make(map[string]*classTotal, len(g.classes.names))
+	for _, name := range g.classes.names {
+		totals[name] = &classTotal{}
+	}
+	for _, n := range g.Entries {
+		client, ok := n.(*Client)
+		if !ok {
+			continue
+		}
+		f := &client.classes
+		handled := client.served + client.lost
+		for _, rc := range client.Classes {
+			t := totals[rc.Name]
+			t.injected += client.injected * rc.Share
+			h := handled * rc.Share
+			failed := h * f.failRate[rc.Name]
+			t.failed += failed
+			t.succeeded += math.Max(0, h-failed-client.retrying*rc.Share)
+			if d := f.latency[rc.Name]; !d.Empty() && h > 0 {
+				t.latency = MixLatency([]LatencyDist{t.latency, d}, []float64{t.weight, h})
+				t.weight += h
+			}
+		}
+	}
+	return totals
+}
+
+// classMetrics returns the tick's class metrics in name order.
+func (g *Graph) classMetrics(totals map[string]*classTotal) []ClassMetrics {
+	if g.classes == nil {
+		return nil
+	}
+	out := make([]ClassMetrics, 0, len(g.classes.names))
+	for _, name := range g.classes.names {
+		t := totals[name]
+		out = append(out, ClassMetrics{
+			Name:           name,
+			InjectedRPS:    t.injected,
+			Succeeded:      t.succeeded,
+			Failed:         t.failed,
+			SuccessRate:    successRate(t.succeeded, t.failed),
+			LatencySummary: t.latency.Summary(),
+		})
+	}
+	return out
+}
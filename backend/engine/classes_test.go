@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+// shop is client c at 100 rps sending search (75%, reads) and checkout (25%,
+// mostly writes) -> app server api, which sends search to index and checkout
+// to db.
+func shop() *ArchitectureConfig {
+	reads, writes := 1.0, 0.2
+	return &ArchitectureConfig{
+		Seed: 1,
+		Nodes: []NodeConfig{
+			{ID: "c", Type: "client", RPS: 100, Classes: []RequestClass{
+				{Name: "search", Share: 3, ReadRatio: &reads, Route: map[string][]string{"api": {"index"}}},
+				{Name: "checkout", Share: 1, ReadRatio: &writes, Route: map[string][]string{"api": {"db"}}},
+			}},
+			{ID: "api", Type: "appserver", MaxRPS: 1000, BaseLatency: 20, ConcurrencyLimit: 1000},
+			{ID: "index", Type: "database", MaxRPS: 1000, BaseLatency: 5, ConcurrencyLimit: 1000},
+			{ID: "db", Type: "database", MaxRPS: 1000, BaseLatency: 10, ConcurrencyLimit: 1000},
+		},
+		Edges: []EdgeConfig{{Source: "c", Target: "api"}, {Source: "api", Target: "index"}, {Source: "api", Target: "db"}},
+	}
+}
+
+// classSummary returns the summary of class name.
+func classSummary(t *testing.T, r *RunResult, name string) ClassSummary {
+	t.Helper()
+	for _, s := range r.Summary.Classes {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("no summary for class %s", name)
+	return ClassSummary{}
+}
+
+// Classes split the traffic by share, are tracked at every node and follow
+// their routes.
+func TestClassesAreTrackedAndRouted(t *testing.T) {
+	r := run(t, shop(), 10)
+	want := map[string]map[string]float64{
+		"api":   {"search": 75, "checkout": 25},
+		"index": {"search": 75},
+		"db":    {"checkout": 25},
+	}
+	for id, classes := range want {
+		m := nodeAt(t, r, 10, id)
+		if len(m.ClassArrivals) != len(classes) {
+			t.Errorf("%s: classes %v, want %v", id, m.ClassArrivals, classes)
+		}
+		for c, rps := range classes {
+			if !near(m.ClassArrivals[c], rps, 1e-6) || !near(m.ClassThroughput[c], rps, 1e-6) {
+				t.Errorf("%s: %s arrived at %v and served %v, want %v", id, c, m.ClassArrivals[c], m.ClassThroughput[c], rps)
+			}
+		}
+	}
+	search, checkout := classSummary(t, r, "search"), classSummary(t, r, "checkout")
+	if search.AvgInjectedRPS != 75 || checkout.AvgInjectedRPS != 25 {
+		t.Errorf("injected %v and %v, want 75 and 25", search.AvgInjectedRPS, checkout.AvgInjectedRPS)
+	}
+	// Each class pays for the route it takes.
+	if !near(search.LatencyMean, 25, 1e-6) || !near(checkout.LatencyMean, 30, 1e-6) {
+		t.Errorf("latency search %v checkout %v, want 25 and 30", search.LatencyMean, checkout.LatencyMean)
+	}
+}
+
+// A costly class uses up a node's capacity faster; classes that don't go
+// there are unaffected.
+func TestClassCost(t *testing.T) {
+	config := shop()
+	config.Nodes[0].Classes[1].Cost = map[string]float64{"db": 8}
+	setNode(config, "db", func(nc *NodeConfig) { nc.MaxRPS = 100 })
+	// db gets through 12.5 checkouts a second, so its 500 request queue
+	// overflows after 40 seconds.
+	r := run(t, config, 60)
+	if db := nodeSummary(t, r, "db"); db.PeakUtilization < 1 || db.PeakQueueDepth == 0 {
+		t.Errorf("db peaked at %v utilization with %v queued, want 25 checkouts at cost 8 to overload 100 rps", db.PeakUtilization, db.PeakQueueDepth)
+	}
+	if s := classSummary(t, r, "checkout"); s.SuccessRate >= 1 {
+		t.Error("no checkout failed at an overloaded db")
+	}
+	if s := classSummary(t, r, "search"); s.SuccessRate != 1 {
+		t.Errorf("search succeeded %v, want 1", s.SuccessRate)
+	}
+}
+
+// Class SLOs are checked against the class's own summary.
+func TestClassSLOs(t *testing.T) {
+	config := shop()
+	config.Nodes[0].Classes[0].SLOs = []string{"p99 <= 30"}
+	config.Nodes[0].Classes[1].SLOs = []string{"p99 <= 25"}
+	r := run(t, config, 10)
+	exprs := config.SLOExprs()
+	if want := "search.p99 <= 30,checkout.p99 <= 25"; strings.Join(exprs, ",") != want {
+		t.Fatalf("SLOs %v, want %s", exprs, want)
+	}
+	for i, want := range []bool{true, false} {
+		slo, err := ParseSLO(exprs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := slo.Check(r.Summary)
+		if err != nil || res.Passed != want {
+			t.Errorf("%s: %+v (%v), want passed %v", exprs[i], res, err, want)
+		}
+	}
+}
+
+func TestClassesAreChecked(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*RequestClass)
+		err    string
+	}{
+		{"no share", func(rc *RequestClass) { rc.Share = 0 }, "share must be positive"},
+		{"cost at unknown node", func(rc *RequestClass) { rc.Cost = map[string]float64{"mainframe": 2} }, "unknown node or node type"},
+		{"route off the graph", func(rc *RequestClass) { rc.Route = map[string][]string{"c": {"db"}} }, "route c -> db is not an edge"},
+		{"named like a node", func(rc *RequestClass) { rc.Name = "db" }, "same name as a node"},
+		{"node-scoped SLO", func(rc *RequestClass) { rc.SLOs = []string{"api.p99 <= 10"} }, "apply to the class"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := shop()
+			tt.change(&config.Nodes[0].Classes[0])
+			if _, err := BuildGraphFromConfig(config); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
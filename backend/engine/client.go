@@ -1,14 +1,28 @@
 package engine
 
+import "math"
+
 // Client represents the traffic source / entry point node.
 // It simply receives injected traffic and forwards it all downstream.
 type Client struct {
 	BaseNode
-	RPS        float64
-	ReadRatio  float64 // 0.0 to 1.0
-	throughput float64
-	readTP     float64
-	writeTP    float64
+	RPS         float64
+	ReadRatio   float64 // 0.0 to 1.0
+	Arrival     string  // "constant" (default), "poisson", "pareto" or "onoff"
+	ParetoShape float64 // tail index for "pareto" arrivals (> 1, smaller is burstier)
+	OnSeconds   float64 // mean length of an ON period for "onoff" arrivals
+	OffSeconds  float64 // mean length of an OFF period for "onoff" arrivals
+	throughput  float64
+	readTP      float64
+	writeTP     float64
+	off         bool    // current state for "onoff" arrivals
+	injected    float64 // new requests per second this tick, retries excluded
+	retry       retrier
+	Classes     []RequestClass // shares normalized, read ratios filled in
+
+	// A traffic scenario, while one of its phases applies, replaces RPS.
+	scripted    bool
+	scriptedRPS float64
 }
 
 // NewClient creates a new Client node.
@@ -19,19 +33,72 @@ func NewClient(id, label string) *Client {
 			NodeType:  "client",
 			NodeLabel: label,
 		},
-		ReadRatio: 0.7, // Default 70% reads
+		ReadRatio:   defaultReadRatio,
+		Arrival:     "constant",
+		ParetoShape: 1.5,
+		OnSeconds:   5,
+		OffSeconds:  5,
+	}
+}
+
+// Stochastic reports whether this client generates random arrivals.
+func (c *Client) Stochastic() bool {
+	return c.Arrival != "" && c.Arrival != "constant"
+}
+
+// rate returns the mean request rate the client is sending at right now.
+func (c *Client) rate() float64 {
+	if c.scripted {
+		return c.scriptedRPS
+	}
+	return c.RPS
+}
+
+// Arrivals returns the rate (requests per second) this client sends at in the
+// next tick. Every mode averages RPS over time; they differ in how bursty they
+// are. Random modes draw a whole number of requests over the tick.
+func (c *Client) Arrivals() float64 {
+	rng := c.random()
+	dt := c.tickSeconds()
+	rps := c.rate()
+	switch c.Arrival {
+	case "poisson":
+		return samplePoisson(rng, rps*dt) / dt
+	case "pareto":
+		return math.Floor(samplePareto(rng, rps*dt, c.ParetoShape)+0.5) / dt
+	case "onoff":
+		on, off := math.Max(dt, c.OnSeconds), math.Max(dt, c.OffSeconds)
+		// Geometric period lengths: leave the current state with dt/mean per tick.
+		if c.off && rng.Float64() < dt/off {
+			c.off = false
+		} else if !c.off && rng.Float64() < dt/on {
+			c.off = true
+		}
+		if c.off {
+			return 0
+		}
+		return samplePoisson(rng, rps*(on+off)/on*dt) / dt
+	default:
+		return rps
 	}
 }
 
 // Process forwards all incoming traffic to downstream nodes.
 func (c *Client) Process() {
-	incoming := c.Incoming
+	// Retries that are due re-enter as extra traffic on top of fresh arrivals.
+	incoming := c.retry.next(c.Incoming)
 	inRead := c.IncomingRead
 	inWrite := c.IncomingWrite
 
+	// The client creates its classes' traffic in their proportions.
+	readRatio := c.ReadRatio
+	var classRead, classWrite map[string]float64
+	if len(c.Classes) > 0 {
+		classRead, classWrite, readRatio = c.classMix()
+	}
+
 	// If traffic was injected as single bucket, split it here
 	if incoming > 0 && inRead == 0 && inWrite == 0 {
-		readRatio := c.ReadRatio
 		inRead = incoming * readRatio
 		inWrite = incoming * (1.0 - readRatio)
 	}
@@ -44,10 +111,15 @@ func (c *Client) Process() {
 		c.lastArrivalR = inRead
 		c.lastArrivalW = inWrite
 	}
+	if len(c.Classes) > 0 {
+		c.setClassMix(classRead, classWrite)
+	}
 
 	c.throughput = inRead + inWrite
 	c.readTP = inRead
 	c.writeTP = inWrite
+	c.localLatency = PointLatency(0)
+	c.served = c.throughput
 
 	downstream := c.Downstream()
 	var healthy []Node
@@ -57,22 +129,38 @@ func (c *Client) Process() {
 		}
 	}
 
-	if len(healthy) > 0 {
+	if len(healthy) == 0 {
+		c.unroutable(c.throughput)
+	} else {
 		if inRead > 0 {
 			perNode := inRead / float64(len(healthy))
 			for _, node := range healthy {
-				node.AddIncomingRead(perNode)
+				c.forward(node, perNode, false)
 			}
 		}
 		if inWrite > 0 {
 			perNode := inWrite / float64(len(healthy))
 			for _, node := range healthy {
-				node.AddIncomingWrite(perNode)
+				c.forward(node, perNode, true)
 			}
 		}
 	}
 }
 
+// Settle retries the requests that failed this tick. Only requests that ran
+// out of attempts (or budget) count as failures.
+func (c *Client) Settle() {
+	c.BaseNode.Settle()
+	exhausted := c.retry.schedule(c.failed, c.tickSeconds())
+	c.retrying = c.failed - exhausted
+	c.setFailed(exhausted)
+}
+
+func (c *Client) fillMetrics(m *NodeMetrics) {
+	c.BaseNode.fillMetrics(m)
+	m.Retries = c.retry.retried
+}
+
 // GetMetrics returns the current metrics for this client.
 func (c *Client) GetMetrics() NodeMetrics {
 	return NodeMetrics{
@@ -96,8 +184,10 @@ func (c *Client) CurrentLatency() float64 {
 	}
 	sum := 0.0
 	for _, node := range downstream {
-		sum += node.CurrentLatency()
+		sum += latencyOf(node)
 	}
 	return sum / float64(len(downstream))
 }
-func (c *Client) ResetQueues() {} // No queue for client
+func (c *Client) ResetQueues() {
+	c.retry.reset()
+}
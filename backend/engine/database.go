@@ -8,6 +8,7 @@ type Database struct {
 	BaseNode
 	CapacityRPS float64
 	BaseLatency float64 // ms
+	ServiceCV   float64 // coefficient of variation of service time (0 = deterministic)
 
 	queueDepth       float64
 	throughput       float64
@@ -19,6 +20,12 @@ type Database struct {
 	IsReplica        bool
 	ConcurrencyLimit float64
 	effectiveLim     float64
+
+	// Replicas apply the primary's write stream, which the DB router hands
+	// over each tick. Writes not applied yet are the replication lag.
+	replicationIn      float64 // writes per second shipped from the primary
+	replicationBacklog float64 // writes not applied yet
+	replicationApplied float64 // writes per second applied this tick
 }
 
 // NewDatabase creates a new Database node.
@@ -39,9 +46,13 @@ func NewDatabase(id, label string, maxRPS, baseLatency float64) *Database {
 func (d *Database) Process() {
 	if d.Down {
 		d.throughput = 0
+		d.readTP = 0
+		d.writeTP = 0
 		d.utilization = 0
 		d.dropped = 0
-		d.ResetIncoming()
+		d.replicationApplied = 0
+		d.replicationBacklog += d.replicationIn * d.tickSeconds()
+		d.failIncoming()
 		return
 	}
 
@@ -50,13 +61,15 @@ func (d *Database) Process() {
 	incomingTotal := d.Incoming + incomingRead + incomingWrite
 	d.ResetIncoming()
 
+	ratedRPS := d.derate(d.CapacityRPS)
 	queueDelay := 0.0
-	if d.CapacityRPS > 0 {
-		queueDelay = (d.queueDepth / d.CapacityRPS) * 1000.0
+	if ratedRPS > 0 {
+		queueDelay = (d.queueDepth / ratedRPS) * 1000.0
 	}
 	totalLatency := d.BaseLatency + queueDelay
 
-	effectiveCapacity := d.CapacityRPS
+	dt := d.tickSeconds()
+	effectiveCapacity := sampleCapacity(d.random(), ratedRPS, d.ServiceCV, dt)
 	if d.ConcurrencyLimit > 0 && totalLatency > 0 {
 		// Signal unlimited/no bottleneck from this logic
 		d.effectiveLim = 0
@@ -64,14 +77,31 @@ func (d *Database) Process() {
 		d.effectiveLim = 0
 	}
 
-	totalArrival := incomingTotal + d.queueDepth
-	processed := math.Min(totalArrival, effectiveCapacity)
+	// Rates are per second; the queue holds requests.
+	queued := d.queueDepth / dt
+	totalArrival := incomingTotal + queued
+
+	// Replication competes with queries; when the replica can't keep up with
+	// both, capacity is shared in proportion to demand and the rest of the
+	// write stream waits.
+	queryCapacity := effectiveCapacity
+	d.replicationApplied = 0
+	if replDemand := d.replicationIn + d.replicationBacklog/dt; replDemand > 0 {
+		applied := replDemand
+		if demand := totalArrival + replDemand; demand > effectiveCapacity {
+			applied = effectiveCapacity * replDemand / demand
+		}
+		d.replicationApplied = applied
+		d.replicationBacklog = (replDemand - applied) * dt
+		queryCapacity -= applied
+	}
+	processed := math.Min(totalArrival, queryCapacity)
 	d.throughput = processed
 
 	if d.IsReplica {
 		// Replicas get "Read Only" traffic. Even if a write accidentally hits them,
 		// they treat all processed capacity as Read Throughput.
-		d.writeTP = 0
+		d.writeTP = d.replicationApplied
 		d.readTP = processed
 	} else {
 		// Primaries prioritize Writes over Reads, but allow arrival-based clearing.
@@ -81,7 +111,7 @@ func (d *Database) Process() {
 			ratio = incomingWrite / incomingTotal
 		}
 
-		writeArrival := incomingWrite + (d.queueDepth * ratio)
+		writeArrival := incomingWrite + (queued * ratio)
 		processedWrite := math.Min(writeArrival, processed)
 
 		// If we are significantly over capacity, reserve at least 10% for Reads
@@ -94,19 +124,26 @@ func (d *Database) Process() {
 		d.readTP = math.Max(0, processed-processedWrite)
 	}
 
-	d.queueDepth = math.Max(0.0, totalArrival-processed)
+	d.classes.service = d.BaseLatency
+	d.localLatency = serverLatency(d.BaseLatency, d.ServiceCV, d.arrivalVar, d.queueDepth, incomingTotal, queryCapacity, ratedRPS, dt)
+	d.served = processed
+
+	d.queueDepth = math.Max(0.0, (totalArrival-processed)*dt)
 
+	// The queue holds at most 5 seconds of work.
 	maxQueue := d.CapacityRPS * 5.0
 	if d.queueDepth > maxQueue {
-		d.dropped = d.queueDepth - maxQueue
-		d.totalDropped += d.dropped
+		excess := d.queueDepth - maxQueue
+		d.dropped = excess / dt
+		d.totalDropped += excess
+		d.lost = d.dropped
 		d.queueDepth = maxQueue
 	} else {
 		d.dropped = 0
 	}
 
-	if d.CapacityRPS > 0.0 {
-		d.utilization = math.Min(incomingTotal/d.CapacityRPS, 1.0)
+	if ratedRPS > 0.0 {
+		d.utilization = math.Min((incomingTotal+d.replicationIn)/ratedRPS, 1.0)
 		if d.queueDepth > 0 || processed < totalArrival-0.1 {
 			d.utilization = 1.0
 		}
@@ -115,14 +152,14 @@ func (d *Database) Process() {
 
 func (d *Database) CurrentLatency() float64 {
 	queueDelay := 0.0
-	if d.CapacityRPS > 0 {
-		queueDelay = (d.queueDepth / d.CapacityRPS) * 1000.0
+	if rated := d.derate(d.CapacityRPS); rated > 0 {
+		queueDelay = (d.queueDepth / rated) * 1000.0
 	}
 	return d.BaseLatency + queueDelay
 }
 
 func (d *Database) GetMetrics() NodeMetrics {
-	lat := d.CurrentLatency()
+	lat := latencyOf(d)
 	return NodeMetrics{
 		ID:                d.NodeID,
 		Type:              d.NodeType,
@@ -143,6 +180,24 @@ func (d *Database) GetMetrics() NodeMetrics {
 	}
 }
 
+// replicationLag returns how far behind the primary a replica is, in ms:
+// the unapplied writes measured in time of the primary's write stream.
+func (d *Database) replicationLag() float64 {
+	if d.replicationBacklog <= 0 {
+		return 0
+	}
+	rate := math.Max(d.replicationIn, d.replicationApplied)
+	if rate <= 0 {
+		rate = math.Max(1, d.derate(d.CapacityRPS))
+	}
+	return d.replicationBacklog / rate * 1000
+}
+
+func (d *Database) fillMetrics(m *NodeMetrics) {
+	d.BaseNode.fillMetrics(m)
+	m.ReplicationLag = d.replicationLag()
+}
+
 func (d *Database) MaxRPS() float64 {
 	return d.CapacityRPS
 }
@@ -0,0 +1,84 @@
+package engine
+
+import "testing"
+
+// cluster is replicated() with c at 1000 rps, one replica r1 of the given
+// capacity, and the router skipping replicas more than maxLagMs behind.
+func cluster(replicaRPS, maxLagMs float64, events ...ChaosEvent) *ArchitectureConfig {
+	config := replicated(nil, events...)
+	removeNode(config, "r2")
+	setNode(config, "c", func(nc *NodeConfig) { nc.RPS = 1000 })
+	setNode(config, "p", func(nc *NodeConfig) { nc.MaxRPS = 2000 })
+	setNode(config, "r1", func(nc *NodeConfig) { nc.MaxRPS = replicaRPS })
+	setNode(config, "router", func(nc *NodeConfig) { nc.MaxLagMs = maxLagMs })
+	return config
+}
+
+// A replica with capacity to spare applies the write stream as it comes.
+func TestReplicationKeepsUp(t *testing.T) {
+	r := run(t, cluster(2000, 0), 10)
+	for i := 1; i <= 10; i++ {
+		if lag := nodeAt(t, r, i, "r1").ReplicationLag; lag != 0 {
+			t.Fatalf("tick %d: replica %vms behind, want 0", i, lag)
+		}
+	}
+	if p, r1 := nodeAt(t, r, 10, "p"), nodeAt(t, r, 10, "r1"); !near(r1.WriteThroughput, p.WriteThroughput, 1e-6) {
+		t.Errorf("replica applied %v writes/s, primary wrote %v", r1.WriteThroughput, p.WriteThroughput)
+	}
+}
+
+// A replica short of capacity shares it between reads and the write stream
+// and falls further behind every second.
+func TestReplicationLag(t *testing.T) {
+	r := run(t, cluster(800, 0), 10)
+	step := nodeAt(t, r, 2, "r1").ReplicationLag
+	if step <= 0 {
+		t.Fatal("an overloaded replica kept up")
+	}
+	for i := 3; i <= 10; i++ {
+		if lag, want := nodeAt(t, r, i, "r1").ReplicationLag, step*float64(i-1); !near(lag, want, 1e-6) {
+			t.Errorf("tick %d: replica %vms behind, want %v", i, lag, want)
+		}
+	}
+}
+
+// With MaxLagMs the router reads from the primary while the replica is too
+// far behind, which lets it catch up.
+func TestMaxLag(t *testing.T) {
+	r := run(t, cluster(800, 500), 20)
+	var stale int
+	for i := 2; i <= 20; i++ {
+		prev := nodeAt(t, r, i-1, "r1").ReplicationLag
+		p := nodeAt(t, r, i, "p")
+		if prev > 500 {
+			stale++
+			if !near(p.ReadThroughput, 700, 1e-6) {
+				t.Errorf("tick %d: primary served %v reads with the replica %vms behind, want all 700", i, p.ReadThroughput, prev)
+			}
+		} else if p.ReadThroughput > 50 {
+			t.Errorf("tick %d: primary served %v reads with the replica %vms behind, want the replica to", i, p.ReadThroughput, prev)
+		}
+		if lag := nodeAt(t, r, i, "r1").ReplicationLag; lag > 800 {
+			t.Errorf("tick %d: replica %vms behind, want it held near 500", i, lag)
+		}
+	}
+	if stale == 0 {
+		t.Error("the replica never fell 500ms behind")
+	}
+	if r.Summary.SuccessRate != 1 {
+		t.Errorf("success rate %v, want 1", r.Summary.SuccessRate)
+	}
+}
+
+// A replica that was down catches up on the writes it missed.
+func TestReplicaCatchesUp(t *testing.T) {
+	r := run(t, cluster(2000, 0, ChaosEvent{At: 3, Action: "down", Node: "r1", Duration: 3}), 10)
+	if lag := nodeAt(t, r, 5, "r1").ReplicationLag; !near(lag, 3000, 150) {
+		t.Errorf("replica %vms behind after three seconds down, want about 3000", lag)
+	}
+	// Back up, it applies the missed writes along with the new ones at once.
+	r1, p := nodeAt(t, r, 6, "r1"), nodeAt(t, r, 6, "p")
+	if r1.ReplicationLag != 0 || r1.WriteThroughput < 4*p.WriteThroughput-1e-6 {
+		t.Errorf("back up, replica applied %v writes/s and is %vms behind, want four seconds' worth and none", r1.WriteThroughput, r1.ReplicationLag)
+	}
+}
@@ -5,12 +5,17 @@ import "math"
 // DBRouter splits traffic into reads (70%) and writes (30%)
 // Writes go to primary (IsReplica: false)
 // Reads go to replicas (IsReplica: true)
+// The databases behind a router form one replicated cluster: replicas apply
+// the primaries' write stream.
 type DBRouter struct {
 	BaseNode
 	throughput float64
 	readTP     float64
 	writeTP    float64
 	ReadRatio  float64 // 0.0 to 1.0 (portion of traffic that is reads)
+	MaxLagMs   float64 // skip replicas further behind than this (0 = never)
+	health     healthChecker
+	failover   failover // primary promotion, when a failover policy is set
 }
 
 // NewDBRouter creates a new DBRouter node.
@@ -21,15 +26,46 @@ func NewDBRouter(id, label string) *DBRouter {
 			NodeType:  "dbrouter",
 			NodeLabel: label,
 		},
-		ReadRatio: 0.7, // default 70% reads
+		ReadRatio: defaultReadRatio,
 	}
 }
 
+// replicate ships what the primaries wrote last tick to every replica.
+// Replication runs between the databases, so it goes on while the router
+// is down.
+func (r *DBRouter) replicate() {
+	var writes float64
+	var replicas []*Database
+	for _, n := range r.Downstream() {
+		db, ok := n.(*Database)
+		switch {
+		case !ok:
+		case db.IsReplica:
+			replicas = append(replicas, db)
+		default:
+			db.replicationIn = 0
+			db.replicationBacklog = 0
+			writes += db.writeTP
+		}
+	}
+	for _, db := range replicas {
+		db.replicationIn = writes
+	}
+}
+
+// fresh reports whether n can serve reads: it isn't a replica lagging more
+// than MaxLagMs behind.
+func (r *DBRouter) fresh(n Node) bool {
+	db, ok := n.(*Database)
+	return r.MaxLagMs <= 0 || !ok || !db.IsReplica || db.replicationLag() <= r.MaxLagMs
+}
+
 // Process splits incoming RPS based on ReadRatio.
 func (r *DBRouter) Process() {
+	r.replicate()
 	if r.Down {
 		r.throughput = 0
-		r.ResetIncoming()
+		r.failIncoming()
 		return
 	}
 
@@ -44,12 +80,36 @@ func (r *DBRouter) Process() {
 	}
 
 	r.ResetIncoming()
+	r.health.probe(&r.BaseNode, r.Downstream())
+	r.localLatency = PointLatency(1.0) // slight routing overhead
+	r.served = incomingTotal
+
+	if r.failover.enabled() {
+		dt := r.tickSeconds()
+		if r.failover.update(&r.BaseNode, r.health.healthy) {
+			if r.failover.Policy.QueueWrites {
+				// Writes wait for the new primary instead of failing, up to
+				// a point.
+				r.lost += r.failover.hold(inWrite, dt)
+				r.served -= inWrite
+				inWrite = 0
+			}
+		} else if held, waitMs := r.failover.release(dt); held > 0 {
+			r.localLatency = MixLatency(
+				[]LatencyDist{PointLatency(1.0), PointLatency(1.0 + waitMs)},
+				[]float64{math.Max(incomingTotal, 1), held})
+			inWrite += held
+			r.served += held
+			incomingTotal += held
+		}
+	}
 	r.readTP = inRead
 	r.writeTP = inWrite
 	r.throughput = incomingTotal
 
 	downstream := r.Downstream()
 	if len(downstream) == 0 {
+		r.unroutable(incomingTotal)
 		return
 	}
 
@@ -57,7 +117,7 @@ func (r *DBRouter) Process() {
 	var allNodes []Node
 
 	for _, n := range downstream {
-		if !n.IsDown() {
+		if r.health.healthy(n) {
 			allNodes = append(allNodes, n)
 			if db, ok := n.(*Database); ok {
 				if !db.IsReplica {
@@ -74,39 +134,39 @@ func (r *DBRouter) Process() {
 	if inWrite > 0 && len(primaries) > 0 {
 		perPrimary := inWrite / float64(len(primaries))
 		for _, p := range primaries {
-			p.AddIncomingWrite(perPrimary)
+			r.forward(p, perPrimary, true)
 		}
-	} else if inWrite > 0 && len(allNodes) > 0 {
-		// Extreme fallback: if no primary, send to anyone so it doesn't just disappear?
-		// Or drop? Let's drop writes if no primary exists.
+	} else {
+		// Writes are dropped if no primary exists, and fail for the caller.
+		r.unroutable(inWrite)
 	}
 
 	// Forward all READs (Replica-First Adaptive Balancing)
 	if inRead > 0 && len(allNodes) > 0 {
 		var replicas []Node
 		for _, n := range allNodes {
-			if db, ok := n.(*Database); ok && db.IsReplica {
+			if db, ok := n.(*Database); ok && db.IsReplica && r.fresh(n) {
 				replicas = append(replicas, n)
 			}
 		}
 
-		targets := allNodes
 		// If healthy replicas exist, send ALL reads there to protect Primary's write capacity
-		if len(replicas) > 0 {
-			targets = replicas
+		targets := replicas
+		if len(targets) == 0 {
+			for _, n := range allNodes {
+				if r.fresh(n) {
+					targets = append(targets, n)
+				}
+			}
 		}
 
-		totalReads := int(math.Floor(inRead + 0.5))
-		base := totalReads / len(targets)
-		remainder := totalReads % len(targets)
-
-		for i, node := range targets {
-			val := float64(base)
-			if i < remainder {
-				val += 1.0
-			}
-			node.AddIncomingRead(val)
+		if len(targets) == 0 {
+			// Only lagging replicas are left.
+			r.unroutable(inRead)
 		}
+		r.spread(inRead, targets, false)
+	} else {
+		r.unroutable(inRead)
 	}
 }
 
@@ -125,6 +185,7 @@ func (r *DBRouter) GetMetrics() NodeMetrics {
 		ReadThroughput:  r.readTP,
 		WriteThroughput: r.writeTP,
 		Throughput:      r.throughput,
+		QueueDepth:      r.failover.queued(),
 		Status:          StatusFromUtilization(util, 0, r.Down),
 		ArrivalRead:     r.lastArrivalR,
 		ArrivalWrite:    r.lastArrivalW,
@@ -144,7 +205,7 @@ func (r *DBRouter) CurrentLatency() float64 {
 	var primaries []Node
 	var replicas []Node
 	for _, n := range downstream {
-		if !n.IsDown() {
+		if r.health.healthy(n) {
 			if db, ok := n.(*Database); ok {
 				if db.IsReplica {
 					replicas = append(replicas, n)
@@ -161,7 +222,7 @@ func (r *DBRouter) CurrentLatency() float64 {
 	if len(primaries) > 0 {
 		sum := 0.0
 		for _, p := range primaries {
-			sum += p.CurrentLatency()
+			sum += latencyOf(p)
 		}
 		avgPrimary = sum / float64(len(primaries))
 	}
@@ -170,7 +231,7 @@ func (r *DBRouter) CurrentLatency() float64 {
 	if len(replicas) > 0 {
 		sum := 0.0
 		for _, rep := range replicas {
-			sum += rep.CurrentLatency()
+			sum += latencyOf(rep)
 		}
 		avgReplica = sum / float64(len(replicas))
 	} else {
@@ -182,4 +243,7 @@ func (r *DBRouter) CurrentLatency() float64 {
 	return latency + 1.0 // + 1ms overhead
 }
 
-func (r *DBRouter) ResetQueues() {} // No internal queue
+// ResetQueues drops writes held during a failover.
+func (r *DBRouter) ResetQueues() {
+	r.failover.held = nil
+}
@@ -0,0 +1,52 @@
+package engine
+
+import "fmt"
+
+// Degradation puts a node in a partial failure instead of taking it down.
+// A brownout shows: the node's health endpoint reports it, so health checks
+// fail. A gray failure doesn't: the node passes regular health checks while
+// serving slowly or with errors, and only a deep check (a real request)
+// notices.
+type Degradation struct {
+	Capacity  *float64 `json:"capacity,omitempty"`  // share of capacity left (unset = unchanged, 0 = none)
+	LatencyMs float64  `json:"latencyMs,omitempty"` // added to every request served
+	ErrorRate float64  `json:"errorRate,omitempty"` // extra share of requests failed (0.0 to 1.0)
+	Gray      bool     `json:"gray,omitempty"`      // passes regular health checks
+}
+
+// check validates the degradation settings.
+func (d *Degradation) check() error {
+	if d.Capacity != nil && (*d.Capacity < 0 || *d.Capacity > 1) {
+		return fmt.Errorf("degradation capacity must be between 0 and 1")
+	}
+	if d.ErrorRate < 0 || d.ErrorRate > 1 {
+		return fmt.Errorf("degradation errorRate must be between 0 and 1")
+	}
+	if d.LatencyMs < 0 {
+		return fmt.Errorf("degradation latencyMs must not be negative")
+	}
+	return nil
+}
+
+// kind names the degradation as reported in metrics.
+func (d *Degradation) kind() string {
+	if d.Gray {
+		return "gray"
+	}
+	return "brownout"
+}
+
+// describe summarizes the degradation for events.
+func (d *Degradation) describe() string {
+	msg := d.kind()
+	if d.Capacity != nil {
+		msg += fmt.Sprintf(", %.0f%% capacity", *d.Capacity*100)
+	}
+	if d.LatencyMs > 0 {
+		msg += fmt.Sprintf(", +%.0fms", d.LatencyMs)
+	}
+	if d.ErrorRate > 0 {
+		msg += fmt.Sprintf(", %.1f%% errors", d.ErrorRate*100)
+	}
+	return msg
+}
@@ -0,0 +1,162 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+)
+
+// FailoverPolicy lets a DB router promote a replica when the primary is lost,
+// the way RDS or Patroni would. The failover window lasts FailoverSeconds of
+// simulated time from the router noticing there is no healthy primary (with
+// health checks, that's after detection). During it writes fail, or with
+// QueueWrites they wait at the router and go to the new primary once it's
+// promoted; a write that has waited HoldSeconds fails, so writes don't pile up
+// forever when there is no replica to promote. The old primary comes back as
+// a replica; with Failback it is switched back to primary as soon as it's
+// healthy again.
+type FailoverPolicy struct {
+	FailoverSeconds float64 `json:"failoverSeconds,omitempty"` // default 3
+	QueueWrites     bool    `json:"queueWrites,omitempty"`
+	HoldSeconds     float64 `json:"holdSeconds,omitempty"` // longest a queued write waits (default 30)
+	Failback        bool    `json:"failback,omitempty"`
+}
+
+// failover tracks the primary of the databases behind a router.
+type failover struct {
+	Policy     *FailoverPolicy
+	clock      float64 // simulated seconds up to the end of this tick
+	lost       bool    // no healthy primary
+	lostAt     float64 // when the primary was lost
+	oldPrimary string  // demoted primary, for failback
+	held       []heldWrites
+}
+
+// heldWrites are writes queued during a failover window.
+type heldWrites struct {
+	at       float64 // end of the tick they arrived in
+	requests float64
+}
+
+// enabled reports whether a failover policy is configured.
+func (f *failover) enabled() bool {
+	return f.Policy != nil
+}
+
+// update checks the databases behind owner at the start of a tick, promoting
+// a replica once the failover window has passed. It reports whether a
+// failover is in progress, i.e. writes have no primary to go to this tick.
+func (f *failover) update(owner *BaseNode, healthy func(Node) bool) bool {
+	f.clock += owner.tickSeconds()
+	var primary *Database
+	var lost, replicas []*Database
+	for _, n := range owner.DownstreamNodes {
+		db, ok := n.(*Database)
+		if !ok {
+			continue
+		}
+		switch {
+		case !db.IsReplica && healthy(db):
+			primary = db
+		case !db.IsReplica:
+			lost = append(lost, db)
+		case healthy(db):
+			replicas = append(replicas, db)
+		}
+	}
+
+	if primary != nil {
+		f.lost = false
+		if f.Policy.Failback && f.oldPrimary != "" && primary.ID() != f.oldPrimary {
+			for _, db := range replicas {
+				if db.ID() == f.oldPrimary {
+					db.IsReplica, primary.IsReplica = false, true
+					owner.emit("failback", fmt.Sprintf("%s is primary again; %s is a replica", db.ID(), primary.ID()))
+					f.oldPrimary = ""
+				}
+			}
+		}
+		return false
+	}
+	if len(lost) == 0 {
+		// No primary was ever configured; nothing to fail over.
+		return false
+	}
+
+	window := f.Policy.FailoverSeconds
+	if window <= 0 {
+		window = 3
+	}
+	if !f.lost {
+		f.lost, f.lostAt = true, f.clock
+		owner.emit("primary-lost", fmt.Sprintf("no healthy primary; failing over in %gs", window))
+	}
+	if f.clock-f.lostAt < window-1e-9 || len(replicas) == 0 {
+		return true
+	}
+
+	// Promote the most up-to-date replica, then the least busy; the lost
+	// primary rejoins as a replica.
+	sort.Slice(replicas, func(i, j int) bool {
+		if replicas[i].replicationBacklog != replicas[j].replicationBacklog {
+			return replicas[i].replicationBacklog < replicas[j].replicationBacklog
+		}
+		return replicas[i].queueDepth < replicas[j].queueDepth
+	})
+	next := replicas[0]
+	next.IsReplica = false
+	for _, db := range lost {
+		db.IsReplica = true
+		f.oldPrimary = db.ID()
+	}
+	msg := fmt.Sprintf("promoted %s to primary after %.3gs; %s will rejoin as a replica", next.ID(), f.clock-f.lostAt, f.oldPrimary)
+	if next.replicationBacklog > 0 {
+		// Asynchronous replication: whatever it hadn't applied is gone.
+		msg += fmt.Sprintf(" (%.0f unreplicated writes lost)", next.replicationBacklog)
+	}
+	owner.emit("failover", msg)
+	f.lost = false
+	return false
+}
+
+// hold queues writes arriving during the failover window (rate, per second).
+// It returns the rate of queued writes that waited HoldSeconds and fail now.
+func (f *failover) hold(writes, dt float64) (expired float64) {
+	if writes > 0 {
+		f.held = append(f.held, heldWrites{f.clock, writes * dt})
+	}
+	limit := f.Policy.HoldSeconds
+	if limit <= 0 {
+		limit = 30
+	}
+	for len(f.held) > 0 && f.clock-f.held[0].at >= limit-1e-9 {
+		expired += f.held[0].requests
+		f.held = f.held[1:]
+	}
+	return expired / dt
+}
+
+// queued returns the writes waiting for a new primary, in requests.
+func (f *failover) queued() float64 {
+	var n float64
+	for _, h := range f.held {
+		n += h.requests
+	}
+	return n
+}
+
+// release returns the queued writes as a rate over this tick, and how long
+// they waited on average in ms.
+func (f *failover) release(dt float64) (writes, waitMs float64) {
+	held := f.queued()
+	if held <= 0 {
+		return 0, 0
+	}
+	var waited float64
+	for _, h := range f.held {
+		// Writes arrived through their tick, half a tick before its end on
+		// average.
+		waited += h.requests * (f.clock - h.at + dt/2)
+	}
+	f.held = nil
+	return held / dt, waited / held * 1000
+}
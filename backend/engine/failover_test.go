@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// replicated is client c (70% reads) at 100 rps -> DB router -> primary p and
+// replicas r1 and r2, the router failing over by policy.
+func replicated(policy *FailoverPolicy, events ...ChaosEvent) *ArchitectureConfig {
+	return &ArchitectureConfig{
+		Seed: 1,
+		Nodes: []NodeConfig{
+			{ID: "c", Type: "client", RPS: 100, ReadRatio: 0.7},
+			{ID: "router", Type: "dbrouter", ReadRatio: 0.7, Failover: policy},
+			{ID: "p", Type: "database", MaxRPS: 1000, BaseLatency: 10, ConcurrencyLimit: 1000},
+			{ID: "r1", Type: "database", MaxRPS: 1000, BaseLatency: 10, ConcurrencyLimit: 1000, IsReplica: true},
+			{ID: "r2", Type: "database", MaxRPS: 500, BaseLatency: 10, ConcurrencyLimit: 1000, IsReplica: true},
+		},
+		Edges: []EdgeConfig{
+			{Source: "c", Target: "router"},
+			{Source: "router", Target: "p"}, {Source: "router", Target: "r1"}, {Source: "router", Target: "r2"},
+		},
+		Chaos: &ChaosPlan{Events: events},
+	}
+}
+
+// routerEvents returns the router's failover events as "type@tick".
+func routerEvents(r *RunResult) []string {
+	var got []string
+	for _, tr := range r.Ticks {
+		for _, e := range tr.Events {
+			if e.NodeID == "router" && !strings.HasPrefix(e.Type, "target-") {
+				got = append(got, fmt.Sprintf("%s@%d", e.Type, e.Tick))
+			}
+		}
+	}
+	return got
+}
+
+// p goes down at tick 6 and is back at tick 15.
+var primaryOutage = ChaosEvent{At: 6, Action: "down", Node: "p", Duration: 9}
+
+// Writes fail for the three second failover window; reads carry on at the
+// replicas. The old primary comes back as a replica.
+func TestFailover(t *testing.T) {
+	r := run(t, replicated(&FailoverPolicy{}, primaryOutage), 20)
+	if got, want := routerEvents(r), []string{"primary-lost@6", "failover@9"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events %v, want %v", got, want)
+	}
+	want := []float64{1, 1, 1, 1, 1, 0.7, 0.7, 0.7, 1, 1}
+	if got := successRates(r)[:10]; !equalRates(got, want) {
+		t.Errorf("success rates %v, want %v", got, want)
+	}
+	if p := nodeAt(t, r, 20, "p"); p.Status == "down" || p.WriteThroughput == 0 {
+		t.Fatalf("p %+v, want it back and applying the write stream", p)
+	}
+	if got := r.Ticks[19].SuccessRate; got != 1 {
+		t.Errorf("success rate %v with p back as a replica, want 1", got)
+	}
+}
+
+// With QueueWrites, writes wait at the router through the window and go to
+// the new primary late rather than failing.
+func TestFailoverQueuesWrites(t *testing.T) {
+	r := run(t, replicated(&FailoverPolicy{QueueWrites: true}, primaryOutage), 10)
+	if r.Summary.SuccessRate != 1 {
+		t.Errorf("success rate %v, want no write lost", r.Summary.SuccessRate)
+	}
+	var queued []float64
+	for i := 5; i <= 9; i++ {
+		queued = append(queued, nodeAt(t, r, i, "router").QueueDepth)
+	}
+	if want := []float64{0, 30, 60, 90, 0}; !equalRates(queued, want) {
+		t.Errorf("writes waiting at the router %v, want %v", queued, want)
+	}
+	if c := r.Ticks[8].Clients[0]; c.LatencyMax < 2000 {
+		t.Errorf("slowest request %vms when the writes went through, want seconds", c.LatencyMax)
+	}
+}
+
+// Queued writes that waited HoldSeconds fail: those from tick 6 time out at
+// tick 8, those from tick 7 make it to the new primary at tick 9.
+func TestFailoverHoldSeconds(t *testing.T) {
+	r := run(t, replicated(&FailoverPolicy{QueueWrites: true, HoldSeconds: 2}, primaryOutage), 10)
+	want := []float64{1, 1, 1, 1, 1, 1, 1, 0.7, 1, 1}
+	if got := successRates(r); !equalRates(got, want) {
+		t.Errorf("success rates %v, want %v", got, want)
+	}
+}
+
+// With Failback the old primary takes over again once it's back.
+func TestFailback(t *testing.T) {
+	r := run(t, replicated(&FailoverPolicy{Failback: true}, primaryOutage), 20)
+	if got, want := routerEvents(r), []string{"primary-lost@6", "failover@9", "failback@15"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events %v, want %v", got, want)
+	}
+	if got := r.Ticks[14].SuccessRate; got != 1 {
+		t.Errorf("success rate %v failing back, want 1", got)
+	}
+}
+
+// With no replica to promote, nothing gets through until the primary is back.
+func TestFailoverWithoutReplicas(t *testing.T) {
+	config := replicated(&FailoverPolicy{}, primaryOutage)
+	removeNode(config, "r1")
+	removeNode(config, "r2")
+	r := run(t, config, 16)
+	if got, want := routerEvents(r), []string{"primary-lost@6"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events %v, want %v", got, want)
+	}
+	for i, rate := range successRates(r) {
+		if want := map[bool]float64{true: 0, false: 1}[i+1 >= 6 && i+1 < 15]; !near(rate, want, 1e-9) {
+			t.Errorf("tick %d: success rate %v, want %v", i+1, rate, want)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package engine
+
+import (
+	"math"
+	"sort"
+)
+
+// Gateway models an API gateway that rate limits traffic at the edge.
+// Requests over the limit are rejected with a 429 and counted, instead of
+// silently disappearing. Two limiters are supported:
+//   - "token-bucket": tokens refill at RateLimit per second up to Burst; each
+//     request spends one token, so short bursts pass but sustained excess is
+//     rejected.
+//   - "leaky-bucket": requests queue in a bucket of size Burst that drains at
+//     RateLimit per second; output is smooth, bursts wait, overflow is rejected.
+//
+// Quotas optionally limit individual clients, each with its own token bucket
+// refilled at the quota rate. Requests count against the client they came
+// from, even through load balancers or other nodes in between; traffic from
+// no client counts against the first node that sent it.
+type Gateway struct {
+	BaseNode
+	RateLimit   float64            // requests per second (0 = unlimited)
+	Burst       float64            // bucket size in requests (defaults to RateLimit)
+	Mode        string             // "token-bucket" or "leaky-bucket"
+	Quotas      map[string]float64 // per-client requests per second
+	BaseLatency float64            // ms
+
+	tokens        float64
+	quotaTokens   map[string]float64
+	bucket        float64            // leaky-bucket backlog
+	bySource      map[string]float64 // arrivals this tick by originating client
+	arrivedBy     map[string]float64 // bySource of the last processed tick
+	throughput    float64
+	readTP        float64
+	writeTP       float64
+	rejected      float64            // 429s per second THIS tick
+	totalRejected float64            // 429s since start
+	rejectedBy    map[string]float64 // 429s per second THIS tick per originating client
+}
+
+// NewGateway creates a new Gateway node with a full token bucket.
+func NewGateway(id, label string, rateLimit float64) *Gateway {
+	return &Gateway{
+		BaseNode: BaseNode{
+			NodeID:    id,
+			NodeType:  "gateway",
+			NodeLabel: label,
+		},
+		RateLimit:   rateLimit,
+		Burst:       rateLimit,
+		Mode:        "token-bucket",
+		Quotas:      make(map[string]float64),
+		BaseLatency: 2,
+		tokens:      rateLimit,
+		quotaTokens: make(map[string]float64),
+		bySource:    make(map[string]float64),
+		arrivedBy:   make(map[string]float64),
+		rejectedBy:  make(map[string]float64),
+	}
+}
+
+// addFrom records which clients arriving traffic came from, for quotas.
+func (g *Gateway) addFrom(byOrigin map[string]float64) {
+	for src, rps := range byOrigin {
+		g.bySource[src] += rps
+	}
+}
+
+// spendTokens takes up to demand requests from a token bucket refilling at
+// rate per second over a tick of dt seconds, and returns how many got a token.
+func spendTokens(tokens *float64, demand, rate, burst, dt float64) float64 {
+	avail := *tokens + rate*dt
+	used := math.Min(demand, avail)
+	*tokens = math.Min(burst, avail-used)
+	return used
+}
+
+// admitQuotas applies per-upstream quotas and returns the rate from each
+// source that may continue to the global limiter.
+func (g *Gateway) admitQuotas(inTotal, dt float64) map[string]float64 {
+	admitted := make(map[string]float64, len(g.bySource))
+	var tracked float64
+	sources := make([]string, 0, len(g.bySource))
+	for src := range g.bySource {
+		sources = append(sources, src)
+	}
+	sort.Strings(sources)
+
+	for _, src := range sources {
+		amount := g.bySource[src]
+		tracked += amount
+		quota, ok := g.Quotas[src]
+		if !ok || quota <= 0 {
+			admitted[src] = amount
+			continue
+		}
+		// A quota's bucket holds one second of requests.
+		tokens, seen := g.quotaTokens[src]
+		if !seen {
+			tokens = quota
+		}
+		allowed := spendTokens(&tokens, amount*dt, quota, quota, dt) / dt
+		g.quotaTokens[src] = tokens
+		admitted[src] = allowed
+		g.rejectedBy[src] += amount - allowed
+	}
+	// Traffic injected directly (no sender) has no quota.
+	if rest := inTotal - tracked; rest > 0 {
+		admitted[""] = rest
+	}
+	return admitted
+}
+
+// Process applies quotas and the global limiter, rejects the excess and
+// forwards the rest downstream.
+func (g *Gateway) Process() {
+	for src := range g.rejectedBy {
+		delete(g.rejectedBy, src)
+	}
+	for src := range g.arrivedBy {
+		delete(g.arrivedBy, src)
+	}
+	if g.Down {
+		g.throughput = 0
+		g.rejected = 0
+		for src := range g.bySource {
+			delete(g.bySource, src)
+		}
+		g.failIncoming()
+		return
+	}
+
+	inRead := g.IncomingRead
+	inWrite := g.IncomingWrite
+	inTotal := g.Incoming + inRead + inWrite
+	g.ResetIncoming()
+
+	// Proportional split if generic traffic exists
+	if inTotal > 0 && inRead == 0 && inWrite == 0 {
+		inRead = inTotal * defaultReadRatio
+		inWrite = inTotal * (1 - defaultReadRatio)
+	}
+
+	dt := g.tickSeconds()
+	admitted := g.admitQuotas(inTotal, dt)
+	g.arrivedBy, g.bySource = g.bySource, g.arrivedBy
+	var afterQuota float64
+	for _, v := range admitted {
+		afterQuota += v
+	}
+
+	burst := g.Burst
+	if burst <= 0 {
+		burst = g.RateLimit
+	}
+
+	rate := g.derate(g.RateLimit)
+
+	// passed is the rate leaving the gateway this tick; overflow is the rate
+	// the global limiter turned away. With a leaky bucket, passed can include
+	// requests accepted in earlier ticks.
+	var passed, overflow float64
+	switch {
+	case g.RateLimit <= 0:
+		passed = afterQuota
+		g.localLatency = PointLatency(g.BaseLatency)
+	case g.Mode == "leaky-bucket":
+		// The bucket drains while it fills, so a tick can take in its free
+		// space plus what leaks out during the tick.
+		queued := g.bucket
+		accepted := math.Min(afterQuota*dt, math.Max(0, burst-g.bucket+rate*dt))
+		overflow = afterQuota - accepted/dt
+		g.bucket += accepted
+		leaked := math.Min(g.bucket, rate*dt)
+		g.bucket -= leaked
+		passed = leaked / dt
+		g.localLatency = queueLatency(g.BaseLatency, queued, accepted/dt, rate, burst, dt)
+	default: // "token-bucket"
+		passed = spendTokens(&g.tokens, afterQuota*dt, rate, burst, dt) / dt
+		overflow = afterQuota - passed
+		g.localLatency = PointLatency(g.BaseLatency)
+	}
+
+	// Attribute global rejections to sources in proportion to what they sent.
+	if overflow > 0 {
+		for src, v := range admitted {
+			if src != "" {
+				g.rejectedBy[src] += overflow * v / afterQuota
+			}
+		}
+	}
+	g.rejected = (inTotal - afterQuota) + overflow
+	g.totalRejected += g.rejected * dt
+
+	readShare := defaultReadRatio
+	if inTotal > 0 {
+		readShare = inRead / inTotal
+	}
+	g.readTP = passed * readShare
+	g.writeTP = passed - g.readTP
+	g.throughput = passed
+	g.served = passed
+	g.lost = g.rejected
+
+	healthy := g.healthyDownstream()
+	if len(healthy) == 0 {
+		g.unroutable(passed)
+		return
+	}
+	if passed == 0 {
+		return
+	}
+	writeTargets := primariesOf(healthy)
+	if len(writeTargets) == 0 {
+		writeTargets = healthy
+	}
+	g.spread(g.writeTP, writeTargets, true)
+	g.spread(g.readTP, healthy, false)
+}
+
+// failRateFor returns the share of requests from source that failed: its
+// 429s, plus its share of what failed after admission. Senders that aren't
+// an origin themselves (e.g. a load balancer) see the overall rate.
+func (g *Gateway) failRateFor(source string) float64 {
+	arrived := g.arrivedBy[source]
+	if arrived <= 0 {
+		return g.failRate
+	}
+	rejected := math.Min(g.rejectedBy[source], arrived)
+	admittedFailRate := 0.0
+	if g.served > 0 {
+		admittedFailRate = math.Max(0, g.failed-g.lost) / g.served
+	}
+	return math.Min(1, (rejected+(arrived-rejected)*admittedFailRate)/arrived)
+}
+
+func (g *Gateway) fillMetrics(m *NodeMetrics) {
+	g.BaseNode.fillMetrics(m)
+	m.Rejected = g.rejected
+	if len(g.rejectedBy) > 0 {
+		m.RejectedBySource = make(map[string]float64, len(g.rejectedBy))
+		for src, v := range g.rejectedBy {
+			m.RejectedBySource[src] = v
+		}
+	}
+}
+
+func (g *Gateway) GetMetrics() NodeMetrics {
+	util := 0.0
+	if rate := g.derate(g.RateLimit); rate > 0 {
+		util = math.Min(g.lastArrivalT/rate, 1.0)
+	}
+	return NodeMetrics{
+		ID:              g.NodeID,
+		Type:            g.NodeType,
+		Label:           g.NodeLabel,
+		Utilization:     util,
+		Latency:         latencyOf(g),
+		QueueDepth:      g.bucket,
+		ReadThroughput:  g.readTP,
+		WriteThroughput: g.writeTP,
+		Throughput:      g.throughput,
+		Dropped:         g.totalRejected,
+		DropRate:        g.rejected,
+		Status:          StatusFromUtilization(util, 0, g.Down),
+		ArrivalRead:     g.lastArrivalR,
+		ArrivalWrite:    g.lastArrivalW,
+		ArrivalTotal:    g.lastArrivalT,
+	}
+}
+
+func (g *Gateway) MaxRPS() float64 {
+	return g.RateLimit
+}
+
+func (g *Gateway) CurrentLatency() float64 {
+	downstreamLatency := 0.0
+	downstream := g.Downstream()
+	if len(downstream) > 0 {
+		sum := 0.0
+		for _, node := range downstream {
+			sum += latencyOf(node)
+		}
+		downstreamLatency = sum / float64(len(downstream))
+	}
+	bucketDelay := 0.0
+	if rate := g.derate(g.RateLimit); rate > 0 {
+		bucketDelay = (g.bucket / rate) * 1000.0
+	}
+	return g.BaseLatency + bucketDelay + downstreamLatency
+}
+
+// ResetQueues empties the leaky bucket and refills the token buckets.
+func (g *Gateway) ResetQueues() {
+	g.bucket = 0
+	g.tokens = g.Burst
+	for src := range g.quotaTokens {
+		delete(g.quotaTokens, src)
+	}
+	g.throughput = 0
+}
@@ -0,0 +1,105 @@
+package engine
+
+import "testing"
+
+// gated is client c at 150 rps -> gateway gw limiting to 100 rps with room
+// for a 200 request burst -> app server api.
+func gated(mode string) *ArchitectureConfig {
+	return &ArchitectureConfig{
+		Seed: 1,
+		Nodes: []NodeConfig{
+			{ID: "c", Type: "client", RPS: 150},
+			{ID: "gw", Type: "gateway", MaxRPS: 100, Burst: 200, LimiterMode: mode},
+			{ID: "api", Type: "appserver", MaxRPS: 1000, ConcurrencyLimit: 1000},
+		},
+		Edges: []EdgeConfig{{Source: "c", Target: "gw"}, {Source: "gw", Target: "api"}},
+	}
+}
+
+// A token bucket lets the excess through until the burst is spent, then
+// rejects it.
+func TestTokenBucket(t *testing.T) {
+	r := run(t, gated("token-bucket"), 10)
+	for _, tt := range []struct {
+		tick             int
+		passed, rejected float64
+	}{{1, 150, 0}, {4, 150, 0}, {5, 100, 50}, {10, 100, 50}} {
+		gw := nodeAt(t, r, tt.tick, "gw")
+		if !near(gw.Throughput, tt.passed, 1e-6) || !near(gw.Rejected, tt.rejected, 1e-6) {
+			t.Errorf("tick %d: passed %v rejected %v, want %v and %v", tt.tick, gw.Throughput, gw.Rejected, tt.passed, tt.rejected)
+		}
+	}
+	if gw := nodeAt(t, r, 10, "gw"); !near(gw.Dropped, 300, 1e-6) {
+		t.Errorf("%v rejected in all, want 300", gw.Dropped)
+	}
+	if got := r.Ticks[9].Clients[0].SuccessRate; !near(got, 2.0/3, 1e-9) {
+		t.Errorf("client success rate %v, want the 429s counted as failures", got)
+	}
+}
+
+// A leaky bucket smooths the output to the limit; bursts wait in the bucket
+// and only what overflows it is rejected.
+func TestLeakyBucket(t *testing.T) {
+	r := run(t, gated("leaky-bucket"), 10)
+	for _, tt := range []struct {
+		tick     int
+		bucket   float64
+		rejected float64
+	}{{1, 50, 0}, {3, 150, 0}, {4, 200, 0}, {5, 200, 50}, {10, 200, 50}} {
+		gw := nodeAt(t, r, tt.tick, "gw")
+		if !near(gw.Throughput, 100, 1e-6) || !near(gw.QueueDepth, tt.bucket, 1e-6) || !near(gw.Rejected, tt.rejected, 1e-6) {
+			t.Errorf("tick %d: passed %v with %v in the bucket and %v rejected, want 100, %v and %v",
+				tt.tick, gw.Throughput, gw.QueueDepth, gw.Rejected, tt.bucket, tt.rejected)
+		}
+	}
+	if first, last := nodeAt(t, r, 1, "gw").Latency, nodeAt(t, r, 10, "gw").Latency; last <= first {
+		t.Errorf("latency %vms with a full bucket, %vms with an empty one, want waiting to show", last, first)
+	}
+}
+
+// quotaed is clients web and mobile at 100 rps each -> gateway gw with mobile
+// held to 50 rps -> app server api, the clients going through a load balancer
+// if viaLB.
+func quotaed(viaLB bool) *ArchitectureConfig {
+	config := &ArchitectureConfig{
+		Seed: 1,
+		Nodes: []NodeConfig{
+			{ID: "web", Type: "client", RPS: 100},
+			{ID: "mobile", Type: "client", RPS: 100},
+			{ID: "gw", Type: "gateway", Quotas: map[string]float64{"mobile": 50}},
+			{ID: "api", Type: "appserver", MaxRPS: 1000, ConcurrencyLimit: 1000},
+		},
+		Edges: []EdgeConfig{{Source: "gw", Target: "api"}},
+	}
+	entry := "gw"
+	if viaLB {
+		entry = "lb"
+		config.Nodes = append(config.Nodes, NodeConfig{ID: "lb", Type: "loadbalancer", MaxRPS: 1e6})
+		config.Edges = append(config.Edges, EdgeConfig{Source: "lb", Target: "gw"})
+	}
+	config.Edges = append(config.Edges, EdgeConfig{Source: "web", Target: entry}, EdgeConfig{Source: "mobile", Target: entry})
+	return config
+}
+
+// Quotas limit each client on its own, even through a load balancer.
+func TestGatewayQuotas(t *testing.T) {
+	for _, viaLB := range []bool{false, true} {
+		r := run(t, quotaed(viaLB), 10)
+		gw := nodeAt(t, r, 10, "gw")
+		if len(gw.RejectedBySource) != 1 || !near(gw.RejectedBySource["mobile"], 50, 1e-6) {
+			t.Errorf("via LB %v: rejected by source %v, want 50 from mobile", viaLB, gw.RejectedBySource)
+		}
+		if !near(gw.Throughput, 150, 1e-6) {
+			t.Errorf("via LB %v: passed %v, want 150", viaLB, gw.Throughput)
+		}
+	}
+
+	r := run(t, quotaed(false), 10)
+	rates := map[string]float64{}
+	for _, c := range r.Ticks[9].Clients {
+		rates[c.ID] = c.SuccessRate
+	}
+	if !near(rates["web"], 1, 1e-9) || !near(rates["mobile"], 0.5, 1e-9) {
+		t.Errorf("success rates %v, want web 1 and mobile 0.5", rates)
+	}
+}
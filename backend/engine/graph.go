@@ -3,43 +3,107 @@ package engine
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"time"
 )
 
 // ---- JSON input structures ----
 
 // NodeConfig represents a node definition from the frontend.
 type NodeConfig struct {
-	ID               string  `json:"id"`
-	Type             string  `json:"type"`
-	Label            string  `json:"label"`
-	RPS              float64 `json:"rps,omitempty"`
-	MaxRPS           float64 `json:"maxRPS,omitempty"`
-	BaseLatency      float64 `json:"baseLatency,omitempty"`
-	IsReplica        bool    `json:"isReplica,omitempty"`
-	Algorithm        string  `json:"algorithm,omitempty"`
-	ReadRatio        float64 `json:"readRatio,omitempty"`
-	ConcurrencyLimit float64 `json:"concurrencyLimit,omitempty"`
+	ID               string             `json:"id"`
+	Type             string             `json:"type"`
+	Label            string             `json:"label"`
+	RPS              float64            `json:"rps,omitempty"`
+	MaxRPS           float64            `json:"maxRPS,omitempty"`
+	BaseLatency      float64            `json:"baseLatency,omitempty"`
+	IsReplica        bool               `json:"isReplica,omitempty"`
+	Algorithm        string             `json:"algorithm,omitempty"`
+	ReadRatio        float64            `json:"readRatio,omitempty"`
+	ConcurrencyLimit float64            `json:"concurrencyLimit,omitempty"`
+	HitRatio         float64            `json:"hitRatio,omitempty"`
+	WriteMode        string             `json:"writeMode,omitempty"`
+	WarmupSeconds    float64            `json:"warmupSeconds,omitempty"`
+	EvictionRate     float64            `json:"evictionRate,omitempty"` // per second
+	PullRPS          float64            `json:"pullRPS,omitempty"`
+	RetentionLimit   float64            `json:"retentionLimit,omitempty"`
+	Arrival          string             `json:"arrival,omitempty"`
+	ParetoShape      float64            `json:"paretoShape,omitempty"`
+	OnSeconds        float64            `json:"onSeconds,omitempty"`
+	OffSeconds       float64            `json:"offSeconds,omitempty"`
+	ServiceCV        float64            `json:"serviceCV,omitempty"`
+	TimeoutMs        float64            `json:"timeoutMs,omitempty"`
+	ErrorRate        float64            `json:"errorRate,omitempty"` // share of requests the node fails (0.0 to 1.0)
+	Retry            *RetryPolicy       `json:"retry,omitempty"`
+	Autoscale        *AutoscalePolicy   `json:"autoscale,omitempty"`
+	Degradation      *Degradation       `json:"degradation,omitempty"` // partial failure from the start
+	HealthCheck      *HealthCheckPolicy `json:"healthCheck,omitempty"` // load balancers, DB routers and app servers
+	Failover         *FailoverPolicy    `json:"failover,omitempty"`    // DB routers only
+	MaxLagMs         float64            `json:"maxLagMs,omitempty"`    // DB routers: skip replicas lagging more than this
+	Classes          []RequestClass     `json:"classes,omitempty"`     // clients only
+
+	// Circuit breaker settings
+	ErrorThreshold     *float64 `json:"errorThreshold,omitempty"` // unset = 0.5; 0 trips on any failure
+	LatencyThresholdMs float64  `json:"latencyThresholdMs,omitempty"`
+	OpenSeconds        float64  `json:"openSeconds,omitempty"`
+	ProbeRatio         float64  `json:"probeRatio,omitempty"`
+	MinRequests        float64  `json:"minRequests,omitempty"`
+
+	// Gateway settings (MaxRPS is the rate limit)
+	Burst       float64            `json:"burst,omitempty"`       // bucket size in requests
+	LimiterMode string             `json:"limiterMode,omitempty"` // "token-bucket" or "leaky-bucket"
+	Quotas      map[string]float64 `json:"quotas,omitempty"`      // client ID -> requests per second
 }
 
 // EdgeConfig represents an edge (connection) from the frontend.
 type EdgeConfig struct {
-	Source string `json:"source"`
-	Target string `json:"target"`
+	Source string  `json:"source"`
+	Target string  `json:"target"`
+	Weight float64 `json:"weight,omitempty"` // target weight for "weighted" load balancers
 }
 
 // ArchitectureConfig is the full topology sent by the frontend.
 type ArchitectureConfig struct {
-	Nodes      []NodeConfig `json:"nodes"`
-	Edges      []EdgeConfig `json:"edges"`
-	TrafficRPS float64      `json:"trafficRPS"`
+	Nodes []NodeConfig `json:"nodes"` // traffic comes from the clients, each at its own RPS
+	Edges []EdgeConfig `json:"edges"`
+	Seed  int64        `json:"seed,omitempty"` // random seed; 0 picks one from the clock
+
+	// Simulated time: each tick covers TickSeconds (default 1), and the live
+	// loop runs Speed simulated seconds per wall-clock second (0.1 to 100,
+	// default 2, i.e. a one-second tick every 500ms).
+	TickSeconds float64 `json:"tickSeconds,omitempty"`
+	Speed       float64 `json:"speed,omitempty"`
+
+	// SLO assertions checked by headless runs, e.g. "p99 <= 250" (see ParseSLO)
+	SLOs []string `json:"slos,omitempty"`
+
+	// Traffic timeline applied from the first tick
+	Scenario *Scenario `json:"scenario,omitempty"`
+
+	// Faults injected from the first tick
+	Chaos *ChaosPlan `json:"chaos,omitempty"`
+
+	// Live updates: what happens to queued work of removed nodes,
+	// RemoveDiscard (default) or RemoveDrain
+	OnRemove string `json:"onRemove,omitempty"`
 }
 
 // Graph holds the constructed simulation graph.
 type Graph struct {
-	Nodes      map[string]Node
-	EntryNode  Node   // traffic injection point (should be a load balancer)
-	Sorted     []Node // topological order
-	TrafficRPS float64
+	Nodes       map[string]Node
+	EntryNode   Node       // primary entry point, the first of Entries
+	Entries     []Node     // where traffic enters: the clients, by ID
+	Sorted      []Node     // processing order
+	Seed        int64      // seed actually used, so a run can be reproduced
+	TickSeconds float64    // simulated seconds per tick
+	Speed       float64    // simulated seconds per wall-clock second
+	Scenario    *Scenario  // traffic timeline, if any
+	Chaos       *ChaosPlan // fault schedule, if any
+	OnRemove    string     // removed-node policy for live updates
+
+	classes  *classSet             // request classes, nil without any
+	configs  map[string]NodeConfig // what each node was built from
+	draining map[string]bool       // removed nodes still emptying their queues
 }
 
 // BuildGraph constructs a simulation graph from the architecture JSON.
@@ -59,9 +123,27 @@ func BuildGraphFromConfig(config *ArchitectureConfig) (*Graph, error) {
 	}
 
 	nodes := make(map[string]Node)
+	configs := make(map[string]NodeConfig, len(config.Nodes))
+
+	// Every node gets its own random stream derived from the seed. With any
+	// stochastic client, arrivals everywhere downstream are random too, which
+	// drives contention waits.
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	arrivalVar := 0.0
+	for _, nc := range config.Nodes {
+		if nc.Type == "client" && nc.Arrival != "" && nc.Arrival != "constant" {
+			arrivalVar = 1.0
+		}
+	}
 
 	// Create all nodes
 	for _, nc := range config.Nodes {
+		if _, dup := nodes[nc.ID]; dup {
+			return nil, fmt.Errorf("duplicate node ID: %s", nc.ID)
+		}
 		var node Node
 		switch nc.Type {
 		case "client":
@@ -70,6 +152,19 @@ func BuildGraphFromConfig(config *ArchitectureConfig) (*Graph, error) {
 			if nc.ReadRatio > 0 {
 				c.ReadRatio = nc.ReadRatio
 			}
+			if nc.Arrival != "" {
+				c.Arrival = nc.Arrival
+			}
+			if nc.ParetoShape > 1 {
+				c.ParetoShape = nc.ParetoShape
+			}
+			if nc.OnSeconds > 0 {
+				c.OnSeconds = nc.OnSeconds
+			}
+			if nc.OffSeconds > 0 {
+				c.OffSeconds = nc.OffSeconds
+			}
+			c.retry.Policy = nc.Retry
 			node = c
 		case "loadbalancer":
 			maxRPS := nc.MaxRPS
@@ -81,6 +176,7 @@ func BuildGraphFromConfig(config *ArchitectureConfig) (*Graph, error) {
 			if nc.Algorithm != "" {
 				lb.Algorithm = nc.Algorithm
 			}
+			lb.health.Policy = nc.HealthCheck
 			node = lb
 		case "appserver":
 			maxRPS := nc.MaxRPS
@@ -92,6 +188,14 @@ func BuildGraphFromConfig(config *ArchitectureConfig) (*Graph, error) {
 				baseLatency = 20 // default 20ms
 			}
 			server := NewAppServer(nc.ID, nc.Label, maxRPS, baseLatency)
+			server.ServiceCV = nc.ServiceCV
+			server.retry.Policy = nc.Retry
+			server.health.Policy = nc.HealthCheck
+			if nc.Autoscale != nil {
+				// MaxRPS is the capacity of one instance.
+				server.scaling.Policy = nc.Autoscale
+				server.scaling.InstanceRPS = maxRPS
+			}
 			if nc.ConcurrencyLimit > 0 {
 				server.ConcurrencyLimit = nc.ConcurrencyLimit
 			}
@@ -107,6 +211,7 @@ func BuildGraphFromConfig(config *ArchitectureConfig) (*Graph, error) {
 			}
 			db := NewDatabase(nc.ID, nc.Label, maxRPS, baseLatency)
 			db.IsReplica = nc.IsReplica
+			db.ServiceCV = nc.ServiceCV
 			if nc.ConcurrencyLimit > 0 {
 				db.ConcurrencyLimit = nc.ConcurrencyLimit
 			}
@@ -116,11 +221,95 @@ func BuildGraphFromConfig(config *ArchitectureConfig) (*Graph, error) {
 			if nc.ReadRatio > 0 {
 				r.ReadRatio = nc.ReadRatio
 			}
+			r.health.Policy = nc.HealthCheck
+			r.failover.Policy = nc.Failover
+			r.MaxLagMs = nc.MaxLagMs
 			node = r
+		case "cache":
+			maxRPS := nc.MaxRPS
+			if maxRPS == 0 {
+				maxRPS = 10000 // default
+			}
+			baseLatency := nc.BaseLatency
+			if baseLatency == 0 {
+				baseLatency = 1 // default 1ms
+			}
+			c := NewCache(nc.ID, nc.Label, maxRPS, baseLatency)
+			if nc.HitRatio > 0 {
+				c.HitRatio = nc.HitRatio
+			}
+			if nc.WriteMode != "" {
+				c.WriteMode = nc.WriteMode
+			}
+			if nc.WarmupSeconds > 0 {
+				c.WarmupSeconds = nc.WarmupSeconds
+			}
+			if nc.EvictionRate < 0 || nc.EvictionRate > 1 {
+				return nil, fmt.Errorf("node %s: evictionRate must be between 0 and 1", nc.ID)
+			}
+			c.EvictionRate = nc.EvictionRate
+			c.ServiceCV = nc.ServiceCV
+			node = c
+		case "queue":
+			q := NewQueue(nc.ID, nc.Label)
+			q.IngestRPS = nc.MaxRPS // 0 = unlimited ingest
+			q.PullRPS = nc.PullRPS
+			q.RetentionLimit = nc.RetentionLimit
+			if nc.BaseLatency > 0 {
+				q.BaseLatency = nc.BaseLatency
+			}
+			node = q
+		case "circuitbreaker":
+			cb := NewCircuitBreaker(nc.ID, nc.Label)
+			if t := nc.ErrorThreshold; t != nil {
+				if *t < 0 || *t > 1 {
+					return nil, fmt.Errorf("node %s: errorThreshold must be between 0 and 1", nc.ID)
+				}
+				cb.ErrorThreshold = *t
+			}
+			cb.LatencyThresholdMs = nc.LatencyThresholdMs
+			if nc.OpenSeconds > 0 {
+				cb.OpenSeconds = nc.OpenSeconds
+			}
+			if nc.ProbeRatio > 0 {
+				cb.ProbeRatio = nc.ProbeRatio
+			}
+			if nc.MinRequests > 0 {
+				cb.MinRequests = nc.MinRequests
+			}
+			node = cb
+		case "gateway":
+			gw := NewGateway(nc.ID, nc.Label, nc.MaxRPS)
+			if nc.Burst > 0 {
+				gw.Burst = nc.Burst
+				gw.tokens = nc.Burst
+			}
+			if nc.LimiterMode != "" {
+				gw.Mode = nc.LimiterMode
+			}
+			for src, quota := range nc.Quotas {
+				gw.Quotas[src] = quota
+			}
+			if nc.BaseLatency > 0 {
+				gw.BaseLatency = nc.BaseLatency
+			}
+			node = gw
 		default:
 			return nil, fmt.Errorf("unknown node type: %s", nc.Type)
 		}
+		b := baseOf(node)
+		b.seedRand(seed)
+		b.arrivalVar = arrivalVar
+		b.TimeoutMs = nc.TimeoutMs
+		b.ErrorRate = nc.ErrorRate
+		if nc.Degradation != nil {
+			if err := nc.Degradation.check(); err != nil {
+				return nil, fmt.Errorf("node %s: %w", nc.ID, err)
+			}
+			b.Degraded = nc.Degradation
+		}
 		nodes[nc.ID] = node
+		configs[nc.ID] = nc
 	}
 
 	// Build adjacency (downstream connections)
@@ -140,7 +329,9 @@ func BuildGraphFromConfig(config *ArchitectureConfig) (*Graph, error) {
 		if !ok {
 			return nil, fmt.Errorf("edge target node not found: %s", edge.Target)
 		}
-		_ = src
+		if lb, ok := src.(*LoadBalancer); ok && edge.Weight > 0 {
+			lb.Weights[edge.Target] = edge.Weight
+		}
 		downstreamMap[edge.Source] = append(downstreamMap[edge.Source], tgt)
 		inDegree[edge.Target]++
 	}
@@ -152,41 +343,106 @@ func BuildGraphFromConfig(config *ArchitectureConfig) (*Graph, error) {
 		}
 	}
 
-	// Find entry nodes (in-degree 0)
+	// Entry points are the clients; without any, the nodes nothing sends to
 	var entryNodes []Node
-	for id, deg := range inDegree {
-		if deg == 0 {
+	for _, id := range sortedIDs(nodes) {
+		if _, ok := nodes[id].(*Client); ok {
 			entryNodes = append(entryNodes, nodes[id])
 		}
 	}
+	if len(entryNodes) == 0 {
+		for _, id := range sortedIDs(nodes) {
+			if inDegree[id] == 0 {
+				entryNodes = append(entryNodes, nodes[id])
+			}
+		}
+	}
 
+	// Processing order; cycles are allowed and run over back edges, as long
+	// as requests can leave them
+	if cycles := checkCycles(config); len(cycles) > 0 {
+		return nil, fmt.Errorf("%s", cycles[0].Message)
+	}
+	sorted := processingOrder(nodes, config.Edges)
+	markBackEdges(sorted)
 	if len(entryNodes) == 0 {
-		return nil, fmt.Errorf("no entry node found (all nodes have incoming edges — cycle?)")
+		// Every node is on or behind a cycle.
+		entryNodes = sorted[:1]
 	}
 
-	// Topological sort (Kahn's algorithm)
-	sorted, err := topoSort(nodes, config.Edges)
+	classes, err := buildClasses(config.Nodes, nodes)
 	if err != nil {
 		return nil, err
 	}
 
-	trafficRPS := config.TrafficRPS
-	if trafficRPS == 0 {
-		trafficRPS = 100
+	if config.Scenario != nil {
+		if err := config.Scenario.Compile(); err != nil {
+			return nil, fmt.Errorf("scenario: %w", err)
+		}
+		if err := config.Scenario.checkClients(nodes); err != nil {
+			return nil, fmt.Errorf("scenario: %w", err)
+		}
 	}
 
-	return &Graph{
-		Nodes:      nodes,
-		EntryNode:  entryNodes[0], // primary entry
-		Sorted:     sorted,
-		TrafficRPS: trafficRPS,
-	}, nil
+	if config.Chaos != nil {
+		if err := config.Chaos.check(nodes); err != nil {
+			return nil, fmt.Errorf("chaos: %w", err)
+		}
+	}
+
+	switch config.OnRemove {
+	case "", RemoveDiscard, RemoveDrain:
+	default:
+		return nil, fmt.Errorf("unknown onRemove policy: %s", config.OnRemove)
+	}
+
+	tickSeconds := config.TickSeconds
+	if tickSeconds <= 0 {
+		tickSeconds = 1
+	}
+	speed := config.Speed
+	if speed <= 0 {
+		speed = DefaultSpeed
+	}
+
+	graph := &Graph{
+		Nodes:       nodes,
+		EntryNode:   entryNodes[0],
+		Entries:     entryNodes,
+		Sorted:      sorted,
+		Seed:        seed,
+		TickSeconds: tickSeconds,
+		Speed:       clampSpeed(speed),
+		Scenario:    config.Scenario,
+		Chaos:       config.Chaos,
+		OnRemove:    config.OnRemove,
+		classes:     classes,
+		configs:     configs,
+	}
+	graph.shareClasses()
+	return graph, nil
+}
+
+// sortedIDs returns the node IDs in lexical order, so that graph construction
+// and processing order don't depend on map iteration.
+func sortedIDs(nodes map[string]Node) []string {
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
 }
 
-// topoSort performs topological sort using Kahn's algorithm.
-func topoSort(nodes map[string]Node, edges []EdgeConfig) ([]Node, error) {
+// processingOrder orders the nodes so that requests flow forward: every node
+// runs after the nodes that send to it (Kahn's algorithm). Where a cycle
+// blocks that, it is broken at a node that already has traffic from upstream,
+// with the fewest unprocessed senders and then the lowest ID. The edges
+// closing the cycle become back edges (see markBackEdges).
+func processingOrder(nodes map[string]Node, edges []EdgeConfig) []Node {
 	inDeg := make(map[string]int)
 	adj := make(map[string][]string)
+	fed := make(map[string]bool) // has a sender that has run
 
 	for id := range nodes {
 		inDeg[id] = 0
@@ -196,30 +452,65 @@ func topoSort(nodes map[string]Node, edges []EdgeConfig) ([]Node, error) {
 		inDeg[e.Target]++
 	}
 
+	ids := sortedIDs(nodes)
 	var queue []string
-	for id, d := range inDeg {
-		if d == 0 {
+	for _, id := range ids {
+		if inDeg[id] == 0 {
 			queue = append(queue, id)
 		}
 	}
 
+	done := make(map[string]bool)
 	var sorted []Node
-	for len(queue) > 0 {
+	for len(sorted) < len(nodes) {
+		if len(queue) == 0 {
+			best := ""
+			for _, id := range ids {
+				if done[id] {
+					continue
+				}
+				if best == "" || fed[id] && !fed[best] || fed[id] == fed[best] && inDeg[id] < inDeg[best] {
+					best = id
+				}
+			}
+			queue = append(queue, best)
+		}
 		curr := queue[0]
 		queue = queue[1:]
+		done[curr] = true
 		sorted = append(sorted, nodes[curr])
 
 		for _, next := range adj[curr] {
+			fed[next] = true
 			inDeg[next]--
-			if inDeg[next] == 0 {
+			if inDeg[next] == 0 && !done[next] {
 				queue = append(queue, next)
 			}
 		}
 	}
 
-	if len(sorted) != len(nodes) {
-		return nil, fmt.Errorf("graph has a cycle — topological sort failed")
-	}
+	return sorted
+}
 
-	return sorted, nil
+// markBackEdges records, on every node, the downstream nodes that come no
+// later in sorted. Requests sent over those edges arrive a tick late, since
+// the receiver has already run, and the sender sees the receiver's latency
+// and failures from the last tick.
+func markBackEdges(sorted []Node) {
+	pos := make(map[string]int, len(sorted))
+	for i, n := range sorted {
+		pos[n.ID()] = i
+	}
+	for i, n := range sorted {
+		b := baseOf(n)
+		b.backEdges = nil
+		for _, d := range n.Downstream() {
+			if j, ok := pos[d.ID()]; ok && j <= i {
+				if b.backEdges == nil {
+					b.backEdges = make(map[string]bool)
+				}
+				b.backEdges[d.ID()] = true
+			}
+		}
+	}
 }
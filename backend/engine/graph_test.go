@@ -0,0 +1,217 @@
+package engine
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestProcessingOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		nodes     []string // "c" is a client, the rest app servers
+		edges     [][2]string
+		order     []string
+		backEdges map[string][]string // sender -> targets that run first
+	}{
+		{
+			name:  "chain",
+			nodes: []string{"c", "a", "b"},
+			edges: [][2]string{{"c", "a"}, {"a", "b"}},
+			order: []string{"c", "a", "b"},
+		},
+		{
+			name:  "diamond",
+			nodes: []string{"c", "a", "b", "d"},
+			edges: [][2]string{{"c", "a"}, {"c", "b"}, {"a", "d"}, {"b", "d"}},
+			order: []string{"c", "a", "b", "d"},
+		},
+		{
+			name:      "callback cycle is broken where traffic enters it",
+			nodes:     []string{"c", "api", "auth", "db"},
+			edges:     [][2]string{{"c", "api"}, {"api", "auth"}, {"auth", "api"}, {"api", "db"}},
+			order:     []string{"c", "api", "auth", "db"},
+			backEdges: map[string][]string{"auth": {"api"}},
+		},
+		{
+			name:      "cycle entered at its highest ID",
+			nodes:     []string{"c", "x", "y", "z", "s"},
+			edges:     [][2]string{{"c", "z"}, {"x", "y"}, {"y", "z"}, {"z", "x"}, {"x", "s"}},
+			order:     []string{"c", "z", "x", "y", "s"},
+			backEdges: map[string][]string{"y": {"z"}},
+		},
+		{
+			name:      "cycle with no way in starts at the lowest ID",
+			nodes:     []string{"y", "x", "z"},
+			edges:     [][2]string{{"x", "y"}, {"y", "x"}, {"y", "z"}},
+			order:     []string{"x", "y", "z"},
+			backEdges: map[string][]string{"y": {"x"}},
+		},
+		{
+			name:      "self loop",
+			nodes:     []string{"c", "a", "b"},
+			edges:     [][2]string{{"c", "a"}, {"a", "a"}, {"a", "b"}},
+			order:     []string{"c", "a", "b"},
+			backEdges: map[string][]string{"a": {"a"}},
+		},
+		{
+			name:      "nested cycles",
+			nodes:     []string{"c", "a", "b", "d", "e"},
+			edges:     [][2]string{{"c", "a"}, {"a", "b"}, {"b", "a"}, {"b", "d"}, {"d", "a"}, {"d", "e"}},
+			order:     []string{"c", "a", "b", "d", "e"},
+			backEdges: map[string][]string{"b": {"a"}, "d": {"a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &ArchitectureConfig{Seed: 1}
+			for _, id := range tt.nodes {
+				typ := "appserver"
+				if id == "c" {
+					typ = "client"
+				}
+				config.Nodes = append(config.Nodes, NodeConfig{ID: id, Type: typ})
+			}
+			for _, e := range tt.edges {
+				config.Edges = append(config.Edges, EdgeConfig{Source: e[0], Target: e[1]})
+			}
+			g := mustBuild(t, config)
+
+			var order []string
+			for _, n := range g.Sorted {
+				order = append(order, n.ID())
+			}
+			if !reflect.DeepEqual(order, tt.order) {
+				t.Errorf("order = %v, want %v", order, tt.order)
+			}
+
+			backEdges := make(map[string][]string)
+			for _, n := range g.Sorted {
+				for id := range baseOf(n).backEdges {
+					backEdges[n.ID()] = append(backEdges[n.ID()], id)
+				}
+				sort.Strings(backEdges[n.ID()])
+			}
+			want := tt.backEdges
+			if want == nil {
+				want = map[string][]string{}
+			}
+			if !reflect.DeepEqual(backEdges, want) {
+				t.Errorf("back edges = %v, want %v", backEdges, want)
+			}
+		})
+	}
+}
+
+// Requests sent over a back edge arrive on the next tick.
+func TestBackEdgeDeliversNextTick(t *testing.T) {
+	config := &ArchitectureConfig{
+		Seed: 1,
+		Nodes: []NodeConfig{
+			{ID: "c", Type: "client", RPS: 100},
+			{ID: "a", Type: "appserver", MaxRPS: 1000},
+			{ID: "b", Type: "appserver", MaxRPS: 1000},
+			{ID: "db", Type: "database", MaxRPS: 1000},
+		},
+		Edges: []EdgeConfig{{Source: "c", Target: "a"}, {Source: "a", Target: "b"}, {Source: "b", Target: "a"}, {Source: "b", Target: "db"}},
+	}
+	g := mustBuild(t, config)
+	b := baseOf(g.Nodes["b"])
+	b.forward(g.Nodes["a"], 10, false)
+	if len(b.deferred) != 1 || g.Nodes["a"].(*AppServer).IncomingRead != 0 {
+		t.Fatal("back-edge requests were delivered at once")
+	}
+	b.flushDeferred()
+	if got := g.Nodes["a"].(*AppServer).IncomingRead; got != 10 {
+		t.Errorf("a received %v after the flush, want 10", got)
+	}
+}
+
+// loop is client c -> first, first <-> second, with second also sending to
+// the sinks given.
+func loop(typ string, sinks ...string) *ArchitectureConfig {
+	config := &ArchitectureConfig{
+		Seed: 1,
+		Nodes: []NodeConfig{
+			{ID: "c", Type: "client", RPS: 100},
+			{ID: "first", Type: typ, MaxRPS: 1e6},
+			{ID: "second", Type: typ, MaxRPS: 1e6},
+		},
+		Edges: []EdgeConfig{{Source: "c", Target: "first"}, {Source: "first", Target: "second"}, {Source: "second", Target: "first"}},
+	}
+	for _, id := range sinks {
+		config.Nodes = append(config.Nodes, NodeConfig{ID: id, Type: "database", MaxRPS: 1e6})
+		config.Edges = append(config.Edges, EdgeConfig{Source: "second", Target: id})
+	}
+	return config
+}
+
+// A cycle requests can't leave would never finish a request; it's refused.
+func TestCycleWithoutExitIsRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *ArchitectureConfig
+	}{
+		{"load balancers", loop("loadbalancer")},
+		{"app servers", loop("appserver")},
+		{"self loop", &ArchitectureConfig{
+			Nodes: []NodeConfig{{ID: "c", Type: "client"}, {ID: "a", Type: "appserver"}},
+			Edges: []EdgeConfig{{Source: "c", Target: "a"}, {Source: "a", Target: "a"}},
+		}},
+		{"exit into another closed cycle", func() *ArchitectureConfig {
+			config := loop("appserver", "x")
+			setNode(config, "x", func(nc *NodeConfig) { nc.Type = "appserver" })
+			config.Nodes = append(config.Nodes, NodeConfig{ID: "y", Type: "appserver"})
+			config.Edges = append(config.Edges, EdgeConfig{Source: "x", Target: "y"}, EdgeConfig{Source: "y", Target: "x"})
+			return config
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := BuildGraphFromConfig(tt.config); err == nil || !strings.Contains(err.Error(), "no way out") {
+				t.Errorf("build error = %v, want the cycle refused", err)
+			}
+			findings := Validate(tt.config, DefaultRules)
+			if len(findings) == 0 || findings[0].Rule != "cycle" || findings[0].Severity != SeverityError {
+				t.Errorf("findings = %+v, want a cycle error first", findings)
+			}
+		})
+	}
+}
+
+// App servers calling each other settle with bounded traffic when the loop
+// has a way out: second sends half of what it gets back to first.
+func TestAppServerLoop(t *testing.T) {
+	config := loop("appserver", "db")
+	g := mustBuild(t, config)
+	r := RunFor(g, 40, true)
+	first, second, db := nodeAt(t, r, 40, "first"), nodeAt(t, r, 40, "second"), nodeAt(t, r, 40, "db")
+	if !near(first.Throughput, 200, 0.1) || !near(second.Throughput, 200, 0.1) || !near(db.Throughput, 100, 0.1) {
+		t.Errorf("throughput first %v second %v db %v, want 200, 200 and 100", first.Throughput, second.Throughput, db.Throughput)
+	}
+	if first.QueueDepth != 0 || second.QueueDepth != 0 {
+		t.Errorf("queues %v and %v, want none", first.QueueDepth, second.QueueDepth)
+	}
+	if rate := r.Ticks[39].SuccessRate; rate < 0.999 {
+		t.Errorf("success rate %v, want nearly all requests to finish", rate)
+	}
+}
+
+// Requests fail once they have gone around a cycle maxLoops times, rather
+// than circling on for ever.
+func TestLoopLimit(t *testing.T) {
+	for _, typ := range []string{"loadbalancer", "appserver"} {
+		t.Run(typ, func(t *testing.T) {
+			g := mustBuild(t, loop(typ, "db"))
+			RunFor(g, 3*maxLoops, false)
+			// Half of what second gets goes back around: 100/2^k rps arrive
+			// there after k laps, and half of the last lap is failed.
+			if lost, want := baseOf(g.Nodes["second"]).lost, 100/math.Pow(2, maxLoops+1); !near(lost, want, want/100) {
+				t.Errorf("second lost %v rps at the loop limit, want %v", lost, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+)
+
+// HealthCheckPolicy makes a node route only to targets its health checks
+// consider healthy. Targets are probed every IntervalSeconds of simulated
+// time, several times a tick if ticks are longer; a target is marked
+// unhealthy after UnhealthyThreshold failed probes in a row and healthy again
+// after HealthyThreshold passing ones. Until then traffic keeps going to it,
+// so requests sent to a dead target are lost while the failure is being
+// detected.
+//
+// A probe fails when the target is DOWN, in a brownout, or slower than
+// TimeoutMs. Gray failures pass regular probes; with Deep set a probe is a
+// real request and any degradation, including its added latency, shows.
+type HealthCheckPolicy struct {
+	IntervalSeconds    float64 `json:"intervalSeconds,omitempty"`    // default 1
+	TimeoutMs          float64 `json:"timeoutMs,omitempty"`          // 0 = no timeout
+	UnhealthyThreshold int     `json:"unhealthyThreshold,omitempty"` // default 3
+	HealthyThreshold   int     `json:"healthyThreshold,omitempty"`   // default 2
+	Deep               bool    `json:"deep,omitempty"`
+}
+
+// passes reports whether a probe against n succeeds right now.
+func (h *HealthCheckPolicy) passes(n Node) bool {
+	if n.IsDown() {
+		return false
+	}
+	b := baseOf(n)
+	d := b.Degraded
+	if d != nil && !(d.Gray && !h.Deep) {
+		return false
+	}
+	if h.TimeoutMs <= 0 {
+		return true
+	}
+	// Probes wait in the target's queue like any request; only deep probes
+	// pay for a gray failure's slowness.
+	latency := latencyOf(n)
+	if h.Deep {
+		latency += b.extraLatency()
+	}
+	return latency <= h.TimeoutMs
+}
+
+// targetHealth is what a health checker knows about one target.
+type targetHealth struct {
+	unhealthy bool
+	streak    int // consecutive probes disagreeing with the current state
+}
+
+// healthChecker probes a node's downstream targets and remembers which ones
+// it considers healthy.
+type healthChecker struct {
+	Policy  *HealthCheckPolicy
+	clock   float64 // simulated seconds up to the end of this tick
+	next    float64 // when the next probe is due
+	targets map[string]*targetHealth
+}
+
+// enabled reports whether health checks are configured.
+func (h *healthChecker) enabled() bool {
+	return h.Policy != nil
+}
+
+// probe runs the health checks due during this tick against targets and
+// reports state changes on owner. Targets don't change within a tick, so
+// several probes due in one tick all see the same.
+func (h *healthChecker) probe(owner *BaseNode, targets []Node) {
+	if !h.enabled() {
+		return
+	}
+	h.clock += owner.tickSeconds()
+	interval := h.Policy.IntervalSeconds
+	if interval <= 0 {
+		interval = 1
+	}
+	if h.next >= h.clock-1e-9 {
+		return
+	}
+	probes := int(math.Ceil((h.clock-h.next)/interval - 1e-9))
+	h.next += float64(probes) * interval
+	unhealthyAfter := h.Policy.UnhealthyThreshold
+	if unhealthyAfter < 1 {
+		unhealthyAfter = 3
+	}
+	healthyAfter := h.Policy.HealthyThreshold
+	if healthyAfter < 1 {
+		healthyAfter = 2
+	}
+	if h.targets == nil {
+		h.targets = make(map[string]*targetHealth)
+	}
+
+	for _, n := range targets {
+		t, ok := h.targets[n.ID()]
+		if !ok {
+			t = &targetHealth{}
+			h.targets[n.ID()] = t
+		}
+		// A partitioned target can't be probed either.
+		passed := owner.reaches(n) && h.Policy.passes(n)
+		if passed == !t.unhealthy {
+			t.streak = 0
+			continue
+		}
+		t.streak += probes
+		switch {
+		case t.unhealthy && t.streak >= healthyAfter:
+			t.unhealthy, t.streak = false, 0
+			owner.emit("target-healthy", fmt.Sprintf("%s passed %d health checks", n.ID(), healthyAfter))
+		case !t.unhealthy && t.streak >= unhealthyAfter:
+			t.unhealthy, t.streak = true, 0
+			owner.emit("target-unhealthy", fmt.Sprintf("%s failed %d health checks", n.ID(), unhealthyAfter))
+		}
+	}
+}
+
+// healthy reports whether traffic should be sent to n. Without health checks
+// the node sees DOWN targets immediately; with them it goes by its last
+// verdict, so a target that just failed still gets traffic.
+func (h *healthChecker) healthy(n Node) bool {
+	if !h.enabled() {
+		return !n.IsDown()
+	}
+	t, ok := h.targets[n.ID()]
+	return !ok || !t.unhealthy
+}
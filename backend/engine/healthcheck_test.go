@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// checked is balanced(300, round-robin) over a1, a2 and a3, the load balancer
+// health checking them with policy.
+func checked(policy *HealthCheckPolicy, events ...ChaosEvent) *ArchitectureConfig {
+	config := balanced(300, "round-robin", "a1", "a2", "a3")
+	setNode(config, "lb", func(nc *NodeConfig) { nc.HealthCheck = policy })
+	config.Chaos = &ChaosPlan{Events: events}
+	return config
+}
+
+// targetEvents returns the load balancer's verdicts as "verdict@tick".
+func targetEvents(r *RunResult) []string {
+	var got []string
+	for _, tr := range r.Ticks {
+		for _, e := range tr.Events {
+			if strings.HasPrefix(e.Type, "target-") {
+				got = append(got, fmt.Sprintf("%s@%d", strings.TrimPrefix(e.Type, "target-"), e.Tick))
+			}
+		}
+	}
+	return got
+}
+
+// Traffic keeps going to a dead target until three probes in a row fail, and
+// comes back after two pass.
+func TestHealthCheckDetectionDelay(t *testing.T) {
+	down := ChaosEvent{At: 6, Action: "down", Node: "a2", Duration: 10}
+	r := run(t, checked(&HealthCheckPolicy{}, down), 20)
+	if got, want := targetEvents(r), []string{"unhealthy@8", "healthy@17"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("verdicts %v, want %v", got, want)
+	}
+	want := []float64{1, 1, 1, 1, 1, 2.0 / 3, 2.0 / 3, 1, 1, 1}
+	if got := successRates(r)[:10]; !equalRates(got, want) {
+		t.Errorf("success rates %v, want %v", got, want)
+	}
+	if got := nodeAt(t, r, 16, "a2").Throughput; got != 0 {
+		t.Errorf("a2 got %v rps back up before passing its checks, want 0", got)
+	}
+	if got := nodeAt(t, r, 17, "a2").Throughput; !near(got, 100, 1e-6) {
+		t.Errorf("a2 got %v rps once healthy, want 100", got)
+	}
+
+	// Without health checks the load balancer sees DOWN targets at once.
+	config := checked(nil, down)
+	if rate := run(t, config, 20).Summary.SuccessRate; rate != 1 {
+		t.Errorf("success rate %v without health checks, want 1", rate)
+	}
+}
+
+// Probing every half second detects the failure in two ticks.
+func TestHealthCheckInterval(t *testing.T) {
+	r := run(t, checked(&HealthCheckPolicy{IntervalSeconds: 0.5}, ChaosEvent{At: 6, Action: "down", Node: "a2"}), 10)
+	if got, want := targetEvents(r), []string{"unhealthy@7"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("verdicts %v, want %v", got, want)
+	}
+}
+
+// A brownout fails health checks; a gray failure passes regular ones and only
+// deep checks see it.
+func TestHealthCheckDegradation(t *testing.T) {
+	brownout := ChaosEvent{At: 2, Action: "degrade", Node: "a2", Degradation: &Degradation{LatencyMs: 500}}
+	r := run(t, checked(&HealthCheckPolicy{}, brownout), 10)
+	if got, want := targetEvents(r), []string{"unhealthy@4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("brownout: verdicts %v, want %v", got, want)
+	}
+
+	gray := ChaosEvent{At: 2, Action: "degrade", Node: "a2", Degradation: &Degradation{LatencyMs: 500, Gray: true}}
+	for _, tt := range []struct {
+		policy HealthCheckPolicy
+		want   []string
+	}{
+		{HealthCheckPolicy{TimeoutMs: 100}, nil},
+		{HealthCheckPolicy{TimeoutMs: 100, Deep: true}, []string{"unhealthy@4"}},
+	} {
+		r := run(t, checked(&tt.policy, gray), 10)
+		if got := targetEvents(r); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("deep %v: verdicts %v, want %v", tt.policy.Deep, got, tt.want)
+		}
+	}
+}
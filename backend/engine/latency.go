@@ -0,0 +1,326 @@
+package engine
+
+import (
+	"math"
+	"sort"
+)
+
+// latencySketchSize is the number of points kept per latency distribution.
+const latencySketchSize = 64
+
+// LatencySummary holds the percentiles published for a latency distribution.
+type LatencySummary struct {
+	LatencyP50  float64 `json:"latencyP50"`
+	LatencyP90  float64 `json:"latencyP90"`
+	LatencyP95  float64 `json:"latencyP95"`
+	LatencyP99  float64 `json:"latencyP99"`
+	LatencyMax  float64 `json:"latencyMax"`
+	LatencyMean float64 `json:"latencyMean"`
+}
+
+// latencySample is one point of a distribution: a latency (ms) and the share
+// of requests that saw it.
+type latencySample struct {
+	ms     float64
+	weight float64
+}
+
+// LatencyDist is a compact sketch of a latency distribution in ms. It keeps a
+// fixed number of weighted quantile points plus the exact maximum, which is
+// enough to combine distributions along a request path and read off tails.
+type LatencyDist struct {
+	samples []latencySample // sorted by ms
+	max     float64
+}
+
+// PointLatency returns a distribution where every request takes ms.
+func PointLatency(ms float64) LatencyDist {
+	return LatencyDist{samples: []latencySample{{ms, 1}}, max: ms}
+}
+
+// queueLatency returns the latency seen by requests arriving evenly over one
+// tick of dt seconds at a FIFO server: the base service time plus the wait
+// behind the backlog at the moment of arrival. queue is the backlog (requests)
+// at the start of the tick; the backlog grows (or drains) at arrivals-capacity
+// requests per second and never exceeds maxQueue, since anything beyond it is
+// dropped.
+func queueLatency(baseMs, queue, arrivals, capacity, maxQueue, dt float64) LatencyDist {
+	if capacity <= 0 {
+		return PointLatency(baseMs)
+	}
+	d := LatencyDist{samples: make([]latencySample, latencySketchSize)}
+	for i := range d.samples {
+		t := (float64(i) + 0.5) / latencySketchSize
+		backlog := math.Min(maxQueue, math.Max(0, queue+(arrivals-capacity)*t*dt))
+		d.samples[i] = latencySample{baseMs + backlog/capacity*1000.0, 1}
+	}
+	sort.Slice(d.samples, func(a, b int) bool { return d.samples[a].ms < d.samples[b].ms })
+	d.max = d.samples[len(d.samples)-1].ms
+	return d
+}
+
+// serviceLatency returns the distribution of a service time with mean baseMs
+// and coefficient of variation cv (log-normal).
+func serviceLatency(baseMs, cv float64) LatencyDist {
+	if cv <= 0 || baseMs <= 0 {
+		return PointLatency(baseMs)
+	}
+	sigma := math.Sqrt(math.Log(1 + cv*cv))
+	mu := math.Log(baseMs) - sigma*sigma/2
+	d := LatencyDist{samples: make([]latencySample, latencySketchSize)}
+	for i := range d.samples {
+		p := (float64(i) + 0.5) / latencySketchSize
+		z := math.Sqrt2 * math.Erfinv(2*p-1)
+		d.samples[i] = latencySample{math.Exp(mu + sigma*z), 1}
+	}
+	// The true tail is unbounded; report the 99.99th percentile as max.
+	d.max = math.Exp(mu + sigma*3.719)
+	return d
+}
+
+// contentionLatency returns the wait caused by random arrivals colliding
+// within a tick, which the per-tick fluid backlog can't see. It uses the
+// Sakasegawa approximation for a G/G/c queue: c parallel workers, each taking
+// serviceMs per request, at utilization rho. arrivalVar and serviceCV are the
+// squared coefficient of variation of arrivals and the service time CV.
+// With deterministic traffic and service times the wait is zero.
+func contentionLatency(serviceMs, capacity, rho, arrivalVar, serviceCV float64) LatencyDist {
+	variability := (arrivalVar + serviceCV*serviceCV) / 2
+	if variability <= 0 || rho <= 0 || capacity <= 0 {
+		return PointLatency(0)
+	}
+	// Past saturation the fluid backlog already accounts for the wait.
+	rho = math.Min(rho, 0.95)
+	if serviceMs <= 0 {
+		serviceMs = 1000.0 / capacity
+	}
+	c := math.Max(1, capacity*serviceMs/1000.0)
+	exponent := math.Sqrt(2*(c+1)) - 1
+	meanWait := math.Pow(rho, exponent) / (c * (1 - rho)) * variability * serviceMs
+
+	// Requests wait with probability ~rho^exponent; the wait is exponential.
+	pWait := math.Min(1, math.Pow(rho, exponent))
+	condMean := meanWait / pWait
+	d := LatencyDist{samples: make([]latencySample, latencySketchSize)}
+	for i := range d.samples {
+		p := (float64(i) + 0.5) / latencySketchSize
+		wait := 0.0
+		if p > 1-pWait {
+			tail := (1 - p) / pWait
+			wait = -condMean * math.Log(tail)
+		}
+		d.samples[i] = latencySample{wait, 1}
+	}
+	d.max = -condMean * math.Log(0.0001/pWait)
+	return d.compress()
+}
+
+// serverLatency is the local latency of a queueing node: the fluid backlog
+// wait, the contention wait, and the (possibly variable) service time.
+// capacity is what the node could serve this tick; nominal is its configured
+// capacity, which bounds the backlog and sets the utilization.
+func serverLatency(baseMs, serviceCV, arrivalVar, queue, arrivals, capacity, nominal, dt float64) LatencyDist {
+	maxQueue := nominal * 5.0
+	if serviceCV <= 0 && arrivalVar <= 0 {
+		return queueLatency(baseMs, queue, arrivals, capacity, maxQueue, dt)
+	}
+	backlog := queueLatency(0, queue, arrivals, capacity, maxQueue, dt)
+	rho := 0.0
+	if nominal > 0 {
+		rho = arrivals / nominal
+	}
+	return backlog.
+		Then(contentionLatency(baseMs, nominal, rho, arrivalVar, serviceCV)).
+		Then(serviceLatency(baseMs, serviceCV))
+}
+
+// Empty reports whether the distribution holds no requests.
+func (d LatencyDist) Empty() bool {
+	return len(d.samples) == 0
+}
+
+func (d LatencyDist) totalWeight() float64 {
+	var w float64
+	for _, s := range d.samples {
+		w += s.weight
+	}
+	return w
+}
+
+// Mean returns the average latency.
+func (d LatencyDist) Mean() float64 {
+	total := d.totalWeight()
+	if total <= 0 {
+		return 0
+	}
+	var sum float64
+	for _, s := range d.samples {
+		sum += s.ms * s.weight
+	}
+	return sum / total
+}
+
+// Max returns the largest latency seen.
+func (d LatencyDist) Max() float64 {
+	return d.max
+}
+
+// Quantile returns the latency at quantile q (0.0 to 1.0). Each sample is
+// placed at the midpoint of its cumulative weight and values in between are
+// interpolated; above the last sample the curve runs to the exact maximum.
+func (d LatencyDist) Quantile(q float64) float64 {
+	total := d.totalWeight()
+	if total <= 0 {
+		return 0
+	}
+	target := q * total
+	cum := 0.0
+	prevPos, prevMs := 0.0, d.samples[0].ms
+	for _, s := range d.samples {
+		pos := cum + s.weight/2
+		if target <= pos {
+			if pos == prevPos {
+				return s.ms
+			}
+			return prevMs + (s.ms-prevMs)*(target-prevPos)/(pos-prevPos)
+		}
+		cum += s.weight
+		prevPos, prevMs = pos, s.ms
+	}
+	if total == prevPos {
+		return d.max
+	}
+	return prevMs + (d.max-prevMs)*(target-prevPos)/(total-prevPos)
+}
+
+// FractionAbove returns the share of requests slower than ms.
+func (d LatencyDist) FractionAbove(ms float64) float64 {
+	total := d.totalWeight()
+	if total <= 0 || d.max <= ms {
+		return 0
+	}
+	return 1 - d.fractionBelow(ms)/total
+}
+
+// fractionBelow returns the weight at or below ms, interpolating within the
+// sample the cut falls in so the result moves smoothly with ms.
+func (d LatencyDist) fractionBelow(ms float64) float64 {
+	cum := 0.0
+	for i, s := range d.samples {
+		if s.ms > ms {
+			prev := 0.0
+			if i > 0 {
+				prev = d.samples[i-1].ms
+			}
+			if s.ms > prev && ms > prev {
+				cum += s.weight * (ms - prev) / (s.ms - prev)
+			}
+			return cum
+		}
+		cum += s.weight
+	}
+	return cum
+}
+
+// Clip caps every latency at ms — what a caller sees when it gives up after
+// a timeout.
+func (d LatencyDist) Clip(ms float64) LatencyDist {
+	if d.max <= ms {
+		return d
+	}
+	out := LatencyDist{samples: make([]latencySample, len(d.samples)), max: ms}
+	for i, s := range d.samples {
+		out.samples[i] = latencySample{math.Min(s.ms, ms), s.weight}
+	}
+	return out
+}
+
+// plus adds ms to every latency; a negative ms takes it off, down to zero.
+func (d LatencyDist) plus(ms float64) LatencyDist {
+	out := LatencyDist{samples: make([]latencySample, len(d.samples)), max: math.Max(0, d.max+ms)}
+	for i, s := range d.samples {
+		out.samples[i] = latencySample{math.Max(0, s.ms+ms), s.weight}
+	}
+	return out
+}
+
+// Then returns the distribution of a request that spends d here and next
+// afterwards (the sum of two independent latencies).
+func (d LatencyDist) Then(next LatencyDist) LatencyDist {
+	if d.Empty() {
+		return next
+	}
+	if next.Empty() {
+		return d
+	}
+	out := LatencyDist{
+		samples: make([]latencySample, 0, len(d.samples)*len(next.samples)),
+		max:     d.max + next.max,
+	}
+	for _, a := range d.samples {
+		for _, b := range next.samples {
+			out.samples = append(out.samples, latencySample{a.ms + b.ms, a.weight * b.weight})
+		}
+	}
+	return out.compress()
+}
+
+// MixLatency combines distributions of requests that took different paths,
+// weighted by how many requests took each path.
+func MixLatency(parts []LatencyDist, weights []float64) LatencyDist {
+	var out LatencyDist
+	for i, p := range parts {
+		total := p.totalWeight()
+		if weights[i] <= 0 || total <= 0 {
+			continue
+		}
+		for _, s := range p.samples {
+			out.samples = append(out.samples, latencySample{s.ms, s.weight / total * weights[i]})
+		}
+		out.max = math.Max(out.max, p.max)
+	}
+	return out.compress()
+}
+
+// compress sorts the samples and reduces them to latencySketchSize evenly
+// weighted quantile points.
+func (d LatencyDist) compress() LatencyDist {
+	sort.Slice(d.samples, func(a, b int) bool { return d.samples[a].ms < d.samples[b].ms })
+	if len(d.samples) <= latencySketchSize {
+		return d
+	}
+	total := d.totalWeight()
+	out := LatencyDist{samples: make([]latencySample, 0, latencySketchSize), max: d.max}
+	for i := 0; i < latencySketchSize; i++ {
+		q := (float64(i) + 0.5) / latencySketchSize
+		out.samples = append(out.samples, latencySample{d.sampleAt(q * total), 1})
+	}
+	return out
+}
+
+// sampleAt returns the sample value at cumulative weight w (step function).
+func (d LatencyDist) sampleAt(w float64) float64 {
+	cum := 0.0
+	for _, s := range d.samples {
+		cum += s.weight
+		if w <= cum {
+			return s.ms
+		}
+	}
+	return d.samples[len(d.samples)-1].ms
+}
+
+// Summary returns the published percentiles of the distribution.
+func (d LatencyDist) Summary() LatencySummary {
+	if d.Empty() {
+		return LatencySummary{}
+	}
+	return LatencySummary{
+		LatencyP50:  d.Quantile(0.50),
+		LatencyP90:  d.Quantile(0.90),
+		LatencyP95:  d.Quantile(0.95),
+		LatencyP99:  d.Quantile(0.99),
+		LatencyMax:  d.max,
+		LatencyMean: d.Mean(),
+	}
+}
@@ -1,9 +1,17 @@
 package engine
 
-import "math"
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+)
 
-// LoadBalancer distributes incoming traffic across downstream nodes using Round Robin.
-// DOWN nodes are excluded from routing, causing traffic redistribution.
+// LoadBalancer distributes incoming traffic across downstream nodes using the
+// configured Algorithm. DOWN nodes are excluded from routing, causing traffic
+// redistribution. With a health check policy, the load balancer only knows
+// what its probes tell it: failed nodes keep getting traffic until they're
+// detected, and degraded nodes the probes don't catch keep their share.
 type LoadBalancer struct {
 	BaseNode
 	throughput  float64
@@ -11,10 +19,17 @@ type LoadBalancer struct {
 	writeTP     float64
 	utilization float64
 	CapacityRPS float64
-	Algorithm   string // "round-robin", "weighted", "least-connections"
-	rrIndex     int    // index for round-robin distribution
+	Algorithm   string             // "round-robin", "weighted", "least-connections", "power-of-two", "consistent-hash"
+	Weights     map[string]float64 // per-target weight for "weighted" (by target node ID)
+	health      healthChecker      // without a policy, DOWN nodes are skipped at once
+	rrIndex     int                // index for round-robin distribution
 }
 
+// hashVirtualNodes is the number of points each target owns on the
+// consistent-hash ring. With fewer, the arcs vary too much for targets to get
+// even shares.
+const hashVirtualNodes = 512
+
 // NewLoadBalancer creates a new LoadBalancer node.
 func NewLoadBalancer(id, label string) *LoadBalancer {
 	return &LoadBalancer{
@@ -25,15 +40,31 @@ func NewLoadBalancer(id, label string) *LoadBalancer {
 		},
 		CapacityRPS: 500,
 		Algorithm:   "round-robin",
+		Weights:     make(map[string]float64),
 	}
 }
 
+// hashKey returns a stable 64-bit hash of a string. FNV alone leaves similar
+// strings ("app-1#0", "app-1#1") close together, so its result goes through
+// the MurmurHash3 finalizer to spread them over the ring.
+func hashKey(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
 // Process distributes all incoming RPS across healthy downstream nodes.
 // DOWN nodes are skipped — their traffic is redistributed to remaining UP nodes.
 func (lb *LoadBalancer) Process() {
 	if lb.Down {
 		lb.throughput = 0
-		lb.ResetIncoming()
+		lb.failIncoming()
 		return
 	}
 
@@ -41,15 +72,20 @@ func (lb *LoadBalancer) Process() {
 	inWrite := lb.IncomingWrite
 	inTotal := lb.Incoming + inRead + inWrite
 	lb.ResetIncoming()
+	lb.health.probe(&lb.BaseNode, lb.Downstream())
 
 	// Proportional split if generic traffic exists
 	if lb.Incoming > 0 && inRead == 0 && inWrite == 0 {
-		inRead = inTotal * 0.7
-		inWrite = inTotal * 0.3
+		inRead = inTotal * defaultReadRatio
+		inWrite = inTotal * (1 - defaultReadRatio)
 	}
 
 	// Process minimum of incoming requests and load balancer capacity
-	processed := math.Min(inTotal, lb.CapacityRPS)
+	ratedRPS := lb.derate(lb.CapacityRPS)
+	processed := math.Min(inTotal, ratedRPS)
+	lb.localLatency = PointLatency(0.5) // neglible routing overhead
+	lb.served = processed
+	lb.lost = inTotal - processed
 	// Force integer throughput for UI consistency
 	lb.throughput = math.Floor(processed + 0.5)
 
@@ -61,23 +97,28 @@ func (lb *LoadBalancer) Process() {
 	}
 
 	downstream := lb.Downstream()
-	if len(downstream) == 0 || processed == 0.0 {
+	if len(downstream) == 0 {
+		lb.unroutable(processed)
+		return
+	}
+	if processed == 0.0 {
 		return
 	}
 
 	// Filter to only UP nodes
 	var alive []Node
 	for _, node := range downstream {
-		if !node.IsDown() {
+		if lb.routable(node) {
 			alive = append(alive, node)
 		}
 	}
 
 	if len(alive) == 0 {
+		lb.unroutable(processed)
 		return
 	}
 
-	// Distribution with Primary/Replica awareness and Capacity-Weighting
+	// Distribution with Primary/Replica awareness, split by the configured algorithm
 	if processed > 0 {
 		var primaries []Node
 		dedupMap := make(map[string]bool)
@@ -98,42 +139,12 @@ func (lb *LoadBalancer) Process() {
 			}
 		}
 
-		distribute := func(total float64, targets []Node, isWrite bool) {
-			if len(targets) == 0 {
-				return
-			}
-
-			totalInt := int(math.Floor(total + 0.5))
-			if totalInt == 0 {
-				return
-			}
-
-			// Calculate weights by capacity
-			var totalCap float64
-			for _, n := range targets {
-				totalCap += math.Max(1.0, n.MaxRPS())
-			}
-
-			remaining := totalInt
-			for i, n := range targets {
-				var val int
-				if i == len(targets)-1 {
-					val = remaining
-				} else {
-					share := (math.Max(1.0, n.MaxRPS()) / totalCap) * float64(totalInt)
-					val = int(math.Floor(share + 0.5))
-					if val > remaining {
-						val = remaining
-					}
-				}
-
-				if isWrite {
-					n.AddIncomingWrite(float64(val))
-				} else {
-					n.AddIncomingRead(float64(val))
-				}
-				remaining -= val
-			}
+		// Outstanding work per target, seeded with downstream queue depth and
+		// grown as this tick's requests are assigned (used by least-connections
+		// and power-of-two-choices).
+		load := make(map[string]float64, len(uniqueAlive))
+		for _, n := range uniqueAlive {
+			load[n.ID()] = n.GetMetrics().QueueDepth / lb.tickSeconds()
 		}
 
 		// Forward WRITEs to Primaries only
@@ -141,15 +152,220 @@ func (lb *LoadBalancer) Process() {
 		if len(writeTargets) == 0 {
 			writeTargets = uniqueAlive
 		}
-		distribute(lb.writeTP, writeTargets, true)
+		lb.distribute(lb.writeTP, writeTargets, true, load)
 
 		// Forward READs to ALL healthy (unique) nodes
-		distribute(lb.readTP, uniqueAlive, false)
+		lb.distribute(lb.readTP, uniqueAlive, false, load)
+	}
+
+	if ratedRPS > 0 {
+		lb.utilization = math.Min(inTotal/ratedRPS, 1.0)
+	}
+}
+
+// distribute splits total requests across targets according to lb.Algorithm
+// and forwards the integer shares downstream.
+func (lb *LoadBalancer) distribute(total float64, targets []Node, isWrite bool, load map[string]float64) {
+	if len(targets) == 0 {
+		return
+	}
+
+	totalInt := int(math.Floor(total + 0.5))
+	if totalInt == 0 {
+		return
+	}
+
+	var counts []int
+	switch lb.Algorithm {
+	case "weighted":
+		counts = apportion(totalInt, lb.weightShares(targets), 0)
+	case "least-connections":
+		counts = apportion(totalInt, leastConnectionShares(totalInt, targets, load), 0)
+	case "power-of-two":
+		counts = lb.powerOfTwo(totalInt, targets, load)
+	case "consistent-hash":
+		counts = apportion(totalInt, lb.ringShares(targets), 0)
+	default: // "round-robin"
+		shares := make([]float64, len(targets))
+		for i := range shares {
+			shares[i] = 1
+		}
+		// Rotate which targets receive the leftover requests so that, over
+		// several ticks, every target gets the same number of requests.
+		counts = apportion(totalInt, shares, lb.rrIndex)
+		lb.rrIndex = (lb.rrIndex + totalInt%len(targets)) % len(targets)
+	}
+
+	for i, n := range targets {
+		if counts[i] == 0 {
+			continue
+		}
+		load[n.ID()] += float64(counts[i])
+		lb.forward(n, float64(counts[i]), isWrite)
+	}
+}
+
+// apportion splits total into integer counts proportional to shares using the
+// largest-remainder method. Ties are broken starting from index offset.
+func apportion(total int, shares []float64, offset int) []int {
+	counts := make([]int, len(shares))
+	var sum float64
+	for _, s := range shares {
+		sum += s
+	}
+	if sum <= 0 {
+		for i := range shares {
+			shares[i] = 1
+		}
+		sum = float64(len(shares))
 	}
 
-	if lb.CapacityRPS > 0 {
-		lb.utilization = math.Min(inTotal/lb.CapacityRPS, 1.0)
+	assigned := 0
+	rema := make([]float64, len(shares))
+	for i, s := range shares {
+		exact := s / sum * float64(total)
+		counts[i] = int(math.Floor(exact))
+		rema[i] = exact - float64(counts[i])
+		assigned += counts[i]
 	}
+
+	order := make([]int, len(shares))
+	for i := range order {
+		order[i] = (i + offset) % len(shares)
+	}
+	sort.SliceStable(order, func(a, b int) bool { return rema[order[a]] > rema[order[b]] })
+	for i := 0; assigned < total; i++ {
+		counts[order[i%len(order)]]++
+		assigned++
+	}
+	return counts
+}
+
+// weightShares returns the per-target weights. Once any edge has a weight,
+// targets without one count as 1; only with no weights at all are targets
+// weighted by their capacity.
+func (lb *LoadBalancer) weightShares(targets []Node) []float64 {
+	shares := make([]float64, len(targets))
+	for i, n := range targets {
+		switch w, ok := lb.Weights[n.ID()]; {
+		case ok && w > 0:
+			shares[i] = w
+		case len(lb.Weights) > 0:
+			shares[i] = 1
+		default:
+			shares[i] = math.Max(1.0, n.MaxRPS())
+		}
+	}
+	return shares
+}
+
+// leastConnectionShares water-fills the targets: new requests go to the
+// targets with the fewest outstanding requests until their backlogs level out.
+func leastConnectionShares(total int, targets []Node, load map[string]float64) []float64 {
+	levels := make([]float64, len(targets))
+	for i, n := range targets {
+		levels[i] = load[n.ID()]
+	}
+	sorted := append([]float64(nil), levels...)
+	sort.Float64s(sorted)
+
+	// Find the water level L such that sum(max(0, L - level_i)) == total.
+	remaining := float64(total)
+	level := sorted[0]
+	for i := 1; i <= len(sorted); i++ {
+		next := math.Inf(1)
+		if i < len(sorted) {
+			next = sorted[i]
+		}
+		need := (next - level) * float64(i)
+		if need >= remaining {
+			level += remaining / float64(i)
+			break
+		}
+		remaining -= need
+		level = next
+	}
+
+	shares := make([]float64, len(targets))
+	for i := range targets {
+		shares[i] = math.Max(0, level-levels[i])
+	}
+	return shares
+}
+
+// powerOfTwo assigns requests one batch at a time: for each batch it samples
+// two distinct targets at random and picks the one with less outstanding work.
+func (lb *LoadBalancer) powerOfTwo(total int, targets []Node, load map[string]float64) []int {
+	counts := make([]int, len(targets))
+	if len(targets) == 1 {
+		counts[0] = total
+		return counts
+	}
+
+	// Bound the work per tick for very high request rates.
+	batch := total/1000 + 1
+	assigned := make([]float64, len(targets))
+	for remaining := total; remaining > 0; remaining -= batch {
+		n := batch
+		if n > remaining {
+			n = remaining
+		}
+		a := lb.random().Intn(len(targets))
+		b := lb.random().Intn(len(targets) - 1)
+		if b >= a {
+			b++
+		}
+		pick := a
+		if load[targets[b].ID()]+assigned[b] < load[targets[a].ID()]+assigned[a] {
+			pick = b
+		}
+		counts[pick] += n
+		assigned[pick] += float64(n)
+	}
+	return counts
+}
+
+// ringShares returns the fraction of the consistent-hash ring owned by each
+// alive target. The ring is built from every downstream node, so when a target
+// goes DOWN only its arcs move — to the next alive node clockwise — instead of
+// reshuffling all keys.
+func (lb *LoadBalancer) ringShares(targets []Node) []float64 {
+	alive := make(map[string]int, len(targets))
+	for i, n := range targets {
+		alive[n.ID()] = i
+	}
+
+	type point struct {
+		hash uint64
+		id   string
+	}
+	var ring []point
+	for _, n := range lb.Downstream() {
+		for v := 0; v < hashVirtualNodes; v++ {
+			ring = append(ring, point{hashKey(n.ID() + "#" + strconv.Itoa(v)), n.ID()})
+		}
+	}
+	sort.Slice(ring, func(a, b int) bool { return ring[a].hash < ring[b].hash })
+
+	shares := make([]float64, len(targets))
+	for i, p := range ring {
+		prev := ring[(i+len(ring)-1)%len(ring)].hash
+		arc := float64(p.hash - prev) // wraps around correctly for i == 0
+		// Keys on this arc belong to the first alive target at or after p.
+		for j := 0; j < len(ring); j++ {
+			owner := ring[(i+j)%len(ring)].id
+			if idx, ok := alive[owner]; ok {
+				shares[idx] += arc
+				break
+			}
+		}
+	}
+	return shares
+}
+
+// routable reports whether the load balancer sends traffic to n.
+func (lb *LoadBalancer) routable(n Node) bool {
+	return lb.health.healthy(n)
 }
 
 func (lb *LoadBalancer) MaxRPS() float64 {
@@ -160,7 +376,7 @@ func (lb *LoadBalancer) CurrentLatency() float64 {
 	downstream := lb.Downstream()
 	var alive []Node
 	for _, node := range downstream {
-		if !node.IsDown() {
+		if lb.routable(node) {
 			alive = append(alive, node)
 		}
 	}
@@ -169,7 +385,7 @@ func (lb *LoadBalancer) CurrentLatency() float64 {
 	}
 	sum := 0.0
 	for _, node := range alive {
-		sum += node.CurrentLatency()
+		sum += latencyOf(node)
 	}
 	return (sum / float64(len(alive))) + 0.5 // + neglible routing overhead
 }
@@ -177,11 +393,11 @@ func (lb *LoadBalancer) CurrentLatency() float64 {
 // GetMetrics returns the current metrics for this load balancer.
 func (lb *LoadBalancer) GetMetrics() NodeMetrics {
 	util := 0.0
-	if lb.CapacityRPS > 0 {
-		util = lb.throughput / lb.CapacityRPS
+	if rated := lb.derate(lb.CapacityRPS); rated > 0 {
+		util = lb.throughput / rated
 	}
 	status := StatusFromUtilization(util, 0, lb.Down)
-	lat := lb.CurrentLatency()
+	lat := latencyOf(lb)
 	return NodeMetrics{
 		ID:              lb.NodeID,
 		Type:            lb.NodeType,
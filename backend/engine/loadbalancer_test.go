@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+)
+
+// balanced is client c -> load balancer lb -> app servers named by ids.
+func balanced(rps float64, algorithm string, ids ...string) *ArchitectureConfig {
+	config := &ArchitectureConfig{
+		Seed: 1,
+		Nodes: []NodeConfig{
+			{ID: "c", Type: "client", RPS: rps},
+			{ID: "lb", Type: "loadbalancer", MaxRPS: 1e6, Algorithm: algorithm},
+		},
+		Edges: []EdgeConfig{{Source: "c", Target: "lb"}},
+	}
+	for _, id := range ids {
+		config.Nodes = append(config.Nodes, NodeConfig{ID: id, Type: "appserver", MaxRPS: 1000, BaseLatency: 10, ConcurrencyLimit: 1000})
+		config.Edges = append(config.Edges, EdgeConfig{Source: "lb", Target: id})
+	}
+	return config
+}
+
+// received returns the average throughput of each node over a run.
+func received(t *testing.T, r *RunResult, ids ...string) []float64 {
+	t.Helper()
+	var got []float64
+	for _, id := range ids {
+		got = append(got, nodeSummary(t, r, id).AvgThroughput)
+	}
+	return got
+}
+
+func TestRoundRobin(t *testing.T) {
+	r := run(t, balanced(100, "round-robin", "a1", "a2", "a3"), 30)
+	for i, got := range received(t, r, "a1", "a2", "a3") {
+		if !near(got, 100.0/3, 1e-6) {
+			t.Errorf("a%d got %v rps, want 33.3", i+1, got)
+		}
+	}
+}
+
+func TestWeighted(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []float64 // edge weights lb -> a1, a2, a3 (0 = none)
+		maxRPS  []float64
+		want    []float64
+	}{
+		{"edge weights", []float64{3, 1, 2}, []float64{1000, 1000, 1000}, []float64{150, 50, 100}},
+		{"missing weights count as 1", []float64{3, 1, 0}, []float64{1000, 1000, 100}, []float64{180, 60, 60}},
+		{"no weights goes by capacity", []float64{0, 0, 0}, []float64{1000, 500, 1500}, []float64{100, 50, 150}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := balanced(300, "weighted", "a1", "a2", "a3")
+			for i := range tt.weights {
+				id := fmt.Sprintf("a%d", i+1)
+				setNode(config, id, func(nc *NodeConfig) { nc.MaxRPS = tt.maxRPS[i] })
+				config.Edges[i+1].Weight = tt.weights[i]
+			}
+			r := run(t, config, 10)
+			got := received(t, r, "a1", "a2", "a3")
+			for i := range got {
+				if !near(got[i], tt.want[i], 1) {
+					t.Errorf("a%d got %v rps, want %v", i+1, got[i], tt.want[i])
+				}
+			}
+			if r.Summary.SuccessRate != 1 {
+				t.Errorf("success rate %v, want 1", r.Summary.SuccessRate)
+			}
+		})
+	}
+}
+
+// Least connections and power of two choices steer around a slow target that
+// round robin keeps overloading.
+func TestLoadAwareAlgorithms(t *testing.T) {
+	slow := func(algorithm string) *ArchitectureConfig {
+		config := balanced(300, algorithm, "slow", "fast")
+		setNode(config, "slow", func(nc *NodeConfig) { nc.MaxRPS = 50 })
+		return config
+	}
+	rr := run(t, slow("round-robin"), 60).Summary
+	if rr.SuccessRate > 0.95 {
+		t.Fatalf("round robin succeeded %v, want the slow target to drop requests", rr.SuccessRate)
+	}
+	for _, algorithm := range []string{"least-connections", "power-of-two"} {
+		t.Run(algorithm, func(t *testing.T) {
+			r := run(t, slow(algorithm), 60)
+			if r.Summary.SuccessRate < 0.99 {
+				t.Errorf("succeeded %v (round robin %v), want nearly all", r.Summary.SuccessRate, rr.SuccessRate)
+			}
+			if s := nodeSummary(t, r, "slow"); s.AvgThroughput > 50.5 || s.AvgThroughput < 25 {
+				t.Errorf("slow target served %v rps, want close to its 50", s.AvgThroughput)
+			}
+		})
+	}
+}
+
+// Virtual nodes spread every target evenly over the ring.
+func TestRingBalance(t *testing.T) {
+	for _, ids := range [][]string{
+		{"a1", "a2", "a3"},
+		{"app-1", "app-2", "app-3"},
+		{"web-a", "web-b"},
+		{"s1", "s2", "s3", "s4", "s5"},
+	} {
+		t.Run(fmt.Sprint(ids), func(t *testing.T) {
+			g := mustBuild(t, balanced(100, "consistent-hash", ids...))
+			lb := g.Nodes["lb"].(*LoadBalancer)
+			shares := lb.ringShares(lb.Downstream())
+			var total float64
+			for _, s := range shares {
+				total += s
+			}
+			for i, s := range shares {
+				if share := s / total * float64(len(ids)); share < 0.9 || share > 1.1 {
+					t.Errorf("%s owns %.3f of the ring, want %.3f within 10%%", ids[i], s/total, 1/float64(len(ids)))
+				}
+			}
+		})
+	}
+}
+
+// When a target goes DOWN only its keys move; the others keep theirs.
+func TestRingKeepsKeysOfSurvivors(t *testing.T) {
+	g := mustBuild(t, balanced(100, "consistent-hash", "a1", "a2", "a3", "a4"))
+	lb := g.Nodes["lb"].(*LoadBalancer)
+	targets := lb.Downstream()
+	before := lb.ringShares(targets)
+	after := lb.ringShares(append([]Node{targets[0]}, targets[2:]...))
+	var moved float64
+	for i, j := range []int{0, 2, 3} {
+		if after[i] < before[j] {
+			t.Errorf("%s lost ring share when a2 went down", targets[j].ID())
+		}
+		moved += after[i] - before[j]
+	}
+	if !near(moved, before[1], before[1]*1e-9) {
+		t.Errorf("survivors gained %v, want exactly a2's %v", moved, before[1])
+	}
+}
+
+func TestConsistentHashRun(t *testing.T) {
+	config := balanced(300, "consistent-hash", "a1", "a2", "a3")
+	config.Chaos = &ChaosPlan{Events: []ChaosEvent{{At: 11, Action: "down", Node: "a2"}}}
+	r := run(t, config, 20)
+	for _, id := range []string{"a1", "a2", "a3"} {
+		if got := nodeAt(t, r, 10, id).Throughput; !near(got, 100, 10) {
+			t.Errorf("%s got %v rps, want about 100", id, got)
+		}
+	}
+	if a1, a3 := nodeAt(t, r, 20, "a1").Throughput, nodeAt(t, r, 20, "a3").Throughput; !near(a1+a3, 300, 1e-6) {
+		t.Errorf("a1 and a3 got %v and %v with a2 down, want all 300", a1, a3)
+	}
+}
@@ -1,5 +1,15 @@
 package engine
 
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// defaultReadRatio is the share of reads assumed for traffic that arrives
+// without a read/write split, and the default for clients and DB routers.
+const defaultReadRatio = 0.7
+
 // NodeMetrics holds the real-time metrics for a single node.
 type NodeMetrics struct {
 	ID                string  `json:"id"`
@@ -13,11 +23,51 @@ type NodeMetrics struct {
 	Throughput        float64 `json:"throughput"`
 	Dropped           float64 `json:"dropped"`
 	DropRate          float64 `json:"dropRate"`
-	Status            string  `json:"status"` // "healthy", "stressed", "overloaded", "down"
+	Status            string  `json:"status"` // "healthy", "stressed", "overloaded", "degraded", "down"
 	ArrivalRead       float64 `json:"arrivalRead"`
 	ArrivalWrite      float64 `json:"arrivalWrite"`
 	ArrivalTotal      float64 `json:"arrivalTotal"`
 	EffectiveCapacity float64 `json:"effectiveCapacity"`
+
+	// End-to-end latency distribution of requests entering this node
+	LatencySummary
+
+	// Outcome of requests entering this node (drops, errors, timeouts, downstream failures)
+	Succeeded   float64 `json:"succeeded"`
+	Failed      float64 `json:"failed"`
+	SuccessRate float64 `json:"successRate"` // share of finished requests that succeeded
+	FailRate    float64 `json:"failRate"`
+	Errors      float64 `json:"errors,omitempty"` // requests this node completed with an error
+	TimedOut    float64 `json:"timedOut,omitempty"`
+	Retries     float64 `json:"retries,omitempty"`  // retries sent this tick
+	Rejected    float64 `json:"rejected,omitempty"` // requests failed fast without being served
+	Degraded    string  `json:"degraded,omitempty"` // "brownout" or "gray" (see Degradation)
+
+	// Autoscaling app server metrics
+	Instances        int `json:"instances,omitempty"`        // instances serving traffic
+	PendingInstances int `json:"pendingInstances,omitempty"` // instances still provisioning
+
+	// Gateway-only metrics
+	RejectedBySource map[string]float64 `json:"rejectedBySource,omitempty"` // 429s per originating client
+
+	// Circuit-breaker-only metrics
+	BreakerState string `json:"breakerState,omitempty"` // "closed", "open", "half-open"
+
+	// Database-only metrics
+	ReplicationLag float64 `json:"replicationLag,omitempty"` // ms a replica is behind its primary
+
+	// Cache-only metrics
+	HitRatio    float64 `json:"hitRatio,omitempty"`
+	CacheHits   float64 `json:"cacheHits,omitempty"`
+	CacheMisses float64 `json:"cacheMisses,omitempty"`
+
+	// Queue-only metrics
+	Backlog     float64 `json:"backlog,omitempty"`
+	ConsumerLag float64 `json:"consumerLag,omitempty"` // ms until a new message is pulled
+
+	// Request classes (see RequestClass), in requests per second
+	ClassArrivals   map[string]float64 `json:"classArrivals,omitempty"`
+	ClassThroughput map[string]float64 `json:"classThroughput,omitempty"`
 }
 
 // Node is the common interface for all simulation nodes.
@@ -38,6 +88,14 @@ type Node interface {
 	MaxRPS() float64
 	CurrentLatency() float64
 	ResetQueues()
+	// Settle runs after every node has processed the tick, in reverse
+	// processing order, and folds downstream latency into this node's
+	// end-to-end distribution.
+	Settle()
+	LatencyDistribution() LatencyDist
+	// FailRate is the share of requests entering this node in the last tick
+	// that failed anywhere along their path (dropped or timed out).
+	FailRate() float64
 }
 
 // ---- Base node with shared fields ----
@@ -51,12 +109,67 @@ type BaseNode struct {
 	Incoming        float64
 	IncomingRead    float64
 	IncomingWrite   float64
-	Down            bool // UP/DOWN status
+	Down            bool         // UP/DOWN status
+	TimeoutMs       float64      // give up on requests slower than this end-to-end (0 = no timeout)
+	ErrorRate       float64      // share of requests this node completes with an error (0.0 to 1.0)
+	Degraded        *Degradation // partial failure, nil when the node is fully healthy
 	lastArrivalR    float64
 	lastArrivalW    float64
 	lastArrivalT    float64
+
+	rng        *rand.Rand // per-node random stream (see seedRand)
+	arrivalVar float64    // squared CV of arrivals (1 when traffic is stochastic)
+	dt         float64    // simulated seconds per tick (see tickSeconds)
+
+	sent         map[string]float64 // requests forwarded to each downstream node this tick
+	served       float64            // requests completed here this tick
+	localLatency LatencyDist        // time spent in this node this tick
+	latency      LatencyDist        // end-to-end, including downstream
+	lost         float64            // requests that failed here this tick (drops)
+	errors       float64            // requests completed here with an error this tick
+	downFailed   float64            // forwarded requests that failed downstream
+	timedOut     float64            // requests that hit TimeoutMs this tick
+	failed       float64            // requests entering here that failed end-to-end
+	retrying     float64            // failed requests this node will retry
+	failRate     float64
+	events       []Event // state changes to report with this tick
+
+	// Injected faults (see ChaosPlan)
+	capacityLoss float64         // share of capacity lost (0.0 to 1.0)
+	addedLatency float64         // ms added to every request served here
+	partitioned  map[string]bool // downstream nodes this node can't reach
+
+	// Cycles (see markBackEdges)
+	backEdges map[string]bool // downstream nodes that run before this one
+	deferred  []delivery      // requests sent over back edges, due next tick
+	visiting  bool            // guards latencyOf against cycles
+	loopIn    map[int]float64 // arrivals this tick by laps around a cycle (0 not counted)
+	loopMix   map[int]float64 // lap shares of the arrivals this node works with
+	looping   bool            // requests hit maxLoops here this tick
+	looped    bool            // ... and last tick
+
+	classes classFlow // request classes passing through
+
+	// Origins: the clients the requests passing through came from
+	originIn  map[string]float64 // arrivals this tick by origin
+	originMix map[string]float64 // origin shares of the arrivals this node works with
 }
 
+// delivery is a batch of requests on its way to a node.
+type delivery struct {
+	to       Node
+	rps      float64
+	isWrite  bool
+	byClass  map[string]float64 // part of rps by request class
+	byOrigin map[string]float64 // part of rps by originating client
+	byLoop   map[int]float64    // part of rps by laps around a cycle, 0 left out
+}
+
+// maxLoops is how many times a request may go around a cycle. One that comes
+// back again fails instead, so traffic caught in a loop that doesn't lead
+// anywhere fails rather than piling up without bound.
+const maxLoops = 10
+
 func (b *BaseNode) ID() string                   { return b.NodeID }
 func (b *BaseNode) Type() string                 { return b.NodeType }
 func (b *BaseNode) Label() string                { return b.NodeLabel }
@@ -71,6 +184,18 @@ func (b *BaseNode) ResetIncoming() {
 	b.Incoming = 0
 	b.IncomingRead = 0
 	b.IncomingWrite = 0
+
+	// A new tick starts here, so forget what was forwarded in the last one.
+	for id := range b.sent {
+		delete(b.sent, id)
+	}
+	b.served = 0
+	b.lost = 0
+	b.localLatency = LatencyDist{}
+	b.rolloverClasses()
+	b.rolloverOrigins()
+	b.rolloverLoops()
+	b.looped, b.looping = b.looping, false
 }
 func (b *BaseNode) SetDownstream(nodes []Node) { b.DownstreamNodes = nodes }
 func (b *BaseNode) Downstream() []Node         { return b.DownstreamNodes }
@@ -78,6 +203,460 @@ func (b *BaseNode) SetDown(down bool)          { b.Down = down }
 func (b *BaseNode) IsDown() bool               { return b.Down }
 func (b *BaseNode) ResetQueues()               {} // Base does nothing
 
+func (b *BaseNode) LatencyDistribution() LatencyDist { return b.latency }
+func (b *BaseNode) FailRate() float64                { return b.failRate }
+func (b *BaseNode) base() *BaseNode                  { return b }
+
+// tickSeconds returns how much simulated time one tick covers. Traffic is
+// measured in requests per second; queues and other backlogs hold requests,
+// so they grow by rate * tickSeconds each tick.
+func (b *BaseNode) tickSeconds() float64 {
+	if b.dt <= 0 {
+		return 1
+	}
+	return b.dt
+}
+
+// ticksFor returns the whole number of ticks of dt seconds closest to a
+// duration in simulated seconds. Settings are given in seconds so they keep
+// their meaning whatever the tick length.
+func ticksFor(seconds, dt float64) int {
+	return int(math.Round(seconds / dt))
+}
+
+// derate returns what is left of a capacity after injected faults and
+// degradation, counted in requests of the current class mix.
+func (b *BaseNode) derate(capacity float64) float64 {
+	capacity *= (1 - b.capacityLoss) / b.costFactor()
+	if b.Degraded != nil && b.Degraded.Capacity != nil {
+		capacity *= *b.Degraded.Capacity
+	}
+	return capacity
+}
+
+// errorRate returns the share of requests this node fails, including any
+// degradation.
+func (b *BaseNode) errorRate() float64 {
+	if b.Degraded == nil {
+		return b.ErrorRate
+	}
+	return math.Min(1, b.ErrorRate+b.Degraded.ErrorRate)
+}
+
+// extraLatency returns the ms injected faults and degradation add to every
+// request served here.
+func (b *BaseNode) extraLatency() float64 {
+	if b.Degraded == nil {
+		return b.addedLatency
+	}
+	return b.addedLatency + b.Degraded.LatencyMs
+}
+
+// partition cuts (or restores) the edge from this node to a downstream node.
+func (b *BaseNode) partition(target string, cut bool) {
+	if !cut {
+		delete(b.partitioned, target)
+		return
+	}
+	if b.partitioned == nil {
+		b.partitioned = make(map[string]bool)
+	}
+	b.partitioned[target] = true
+}
+
+// reaches reports whether requests sent to n arrive, i.e. the edge to it
+// isn't partitioned.
+func (b *BaseNode) reaches(n Node) bool {
+	return !b.partitioned[n.ID()]
+}
+
+// emit records a state change to be reported in this tick's result.
+func (b *BaseNode) emit(kind, message string) {
+	b.events = append(b.events, Event{NodeID: b.NodeID, Type: kind, Message: message})
+}
+
+// drainEvents returns and clears the events emitted since the last call.
+func (b *BaseNode) drainEvents() []Event {
+	events := b.events
+	b.events = nil
+	return events
+}
+
+// healthyDownstream returns the downstream nodes that are not DOWN.
+func (b *BaseNode) healthyDownstream() []Node {
+	var healthy []Node
+	for _, node := range b.DownstreamNodes {
+		if !node.IsDown() {
+			healthy = append(healthy, node)
+		}
+	}
+	return healthy
+}
+
+// primariesOf returns the nodes that may take writes: every node except
+// database replicas.
+func primariesOf(nodes []Node) []Node {
+	var primaries []Node
+	for _, n := range nodes {
+		if db, ok := n.(*Database); ok && db.IsReplica {
+			continue
+		}
+		primaries = append(primaries, n)
+	}
+	return primaries
+}
+
+// spread forwards total requests evenly across targets in whole requests,
+// giving the remainder to the first targets.
+func (b *BaseNode) spread(total float64, targets []Node, isWrite bool) {
+	if len(targets) == 0 || total <= 0 {
+		return
+	}
+	totalInt := int(math.Floor(total + 0.5))
+	base := totalInt / len(targets)
+	remainder := totalInt % len(targets)
+	for i, node := range targets {
+		val := float64(base)
+		if i < remainder {
+			val += 1.0
+		}
+		b.forward(node, val, isWrite)
+	}
+}
+
+// failIncoming discards this tick's arrivals as failed, for nodes that are
+// DOWN but still receive traffic.
+func (b *BaseNode) failIncoming() {
+	b.ResetIncoming()
+	b.lost = b.lastArrivalT
+}
+
+// unroutable fails requests that should have gone downstream but had nowhere
+// to go: every downstream node is DOWN or there is none, or none can take
+// them (writes with no primary), or they went around a cycle too often.
+// Sinks, app servers and databases without downstream, never lose requests
+// this way.
+func (b *BaseNode) unroutable(n float64) {
+	if n <= 0 || b.isSink() {
+		return
+	}
+	n = math.Min(n, b.served)
+	b.served -= n
+	b.lost += n
+}
+
+// isSink reports whether requests end at this node: it serves them itself and
+// has nothing downstream to call.
+func (b *BaseNode) isSink() bool {
+	return len(b.DownstreamNodes) == 0 && (b.NodeType == "appserver" || b.NodeType == "database")
+}
+
+// baseOf returns the shared fields of a node.
+func baseOf(n Node) *BaseNode {
+	return n.(interface{ base() *BaseNode }).base()
+}
+
+// forward sends requests to a downstream node and records how many were sent,
+// so Settle can weight that node's latency by the traffic it received.
+func (b *BaseNode) forward(n Node, rps float64, isWrite bool) {
+	if rps <= 0 {
+		return
+	}
+	if !b.reaches(n) {
+		// Lost on a partitioned edge.
+		b.unroutable(rps)
+		return
+	}
+	d := delivery{to: n, rps: rps, isWrite: isWrite, byClass: b.splitClasses(rps, isWrite)}
+	if d.byClass != nil {
+		b.holdDetours(&d)
+	}
+	if d.rps > 0 {
+		b.send(d)
+	}
+}
+
+// send records and delivers requests to a downstream node.
+func (b *BaseNode) send(d delivery) {
+	id := d.to.ID()
+	d.byLoop = b.splitLoops(d.rps)
+	if b.backEdges[id] {
+		if d = b.loopBack(d); d.rps <= 0 {
+			return
+		}
+	}
+	d.byOrigin = b.splitOrigins(d.rps)
+	if b.sent == nil {
+		b.sent = make(map[string]float64)
+	}
+	b.sent[id] += d.rps
+	for c, v := range d.byClass {
+		if b.classes.sent == nil {
+			b.classes.sent = make(map[string]map[string]float64)
+		}
+		if b.classes.sent[id] == nil {
+			b.classes.sent[id] = make(map[string]float64)
+		}
+		b.classes.sent[id][c] += v
+	}
+	if b.backEdges[id] {
+		// The target has already run this tick; the requests reach it on the next.
+		b.deferred = append(b.deferred, d)
+		return
+	}
+	b.deliver(d)
+}
+
+// deliver hands requests to their target.
+func (b *BaseNode) deliver(d delivery) {
+	to := baseOf(d.to)
+	to.receiveClasses(d.byClass, d.isWrite)
+	for o, v := range d.byOrigin {
+		if to.originIn == nil {
+			to.originIn = make(map[string]float64)
+		}
+		to.originIn[o] += v
+	}
+	for k, v := range d.byLoop {
+		if to.loopIn == nil {
+			to.loopIn = make(map[int]float64)
+		}
+		to.loopIn[k] += v
+	}
+	if t, ok := d.to.(interface{ addFrom(map[string]float64) }); ok {
+		t.addFrom(d.byOrigin)
+	}
+	if d.isWrite {
+		d.to.AddIncomingWrite(d.rps)
+	} else {
+		d.to.AddIncomingRead(d.rps)
+	}
+}
+
+// flushDeferred delivers the requests sent over back edges last tick.
+func (b *BaseNode) flushDeferred() {
+	for _, d := range b.deferred {
+		b.deliver(d)
+	}
+	b.deferred = nil
+}
+
+// rolloverOrigins turns this tick's arrivals by origin into the mix the node
+// works with. With nothing arriving the last mix stays, for queued work.
+func (b *BaseNode) rolloverOrigins() {
+	var arrived float64
+	for _, v := range b.originIn {
+		arrived += v
+	}
+	if arrived > 0 {
+		mix := make(map[string]float64, len(b.originIn))
+		for o, v := range b.originIn {
+			mix[o] = v / arrived
+		}
+		b.originMix = mix
+	}
+	b.originIn = nil
+}
+
+// splitOrigins divides requests about to be forwarded by the client they came
+// from. Clients, and nodes that only see traffic from no client, are the
+// origin of what they send.
+func (b *BaseNode) splitOrigins(rps float64) map[string]float64 {
+	if b.NodeType == "client" || len(b.originMix) == 0 {
+		return map[string]float64{b.NodeID: rps}
+	}
+	byOrigin := make(map[string]float64, len(b.originMix))
+	for o, share := range b.originMix {
+		byOrigin[o] = rps * share
+	}
+	return byOrigin
+}
+
+// rolloverLoops turns this tick's arrivals by lap into the mix the node works
+// with, like rolloverOrigins. Requests that haven't been around a cycle make
+// up the rest.
+func (b *BaseNode) rolloverLoops() {
+	if b.lastArrivalT > 0 {
+		b.loopMix = nil
+		for k, v := range b.loopIn {
+			if b.loopMix == nil {
+				b.loopMix = make(map[int]float64, len(b.loopIn))
+			}
+			b.loopMix[k] = math.Min(1, v/b.lastArrivalT)
+		}
+	}
+	b.loopIn = nil
+}
+
+// splitLoops divides requests about to be forwarded by how many times they
+// have been around a cycle. It returns nil when none have.
+func (b *BaseNode) splitLoops(rps float64) map[int]float64 {
+	if len(b.loopMix) == 0 {
+		return nil
+	}
+	byLoop := make(map[int]float64, len(b.loopMix))
+	for k, share := range b.loopMix {
+		byLoop[k] = rps * share
+	}
+	return byLoop
+}
+
+// loopBack counts a lap for requests sent over a back edge. Those that would
+// go around more than maxLoops times fail here, and the rest of d shrinks to
+// match.
+func (b *BaseNode) loopBack(d delivery) delivery {
+	byLoop := make(map[int]float64, len(d.byLoop)+1)
+	first := d.rps
+	for k, v := range d.byLoop {
+		byLoop[k+1] = v
+		first -= v
+	}
+	byLoop[1] += math.Max(0, first)
+	over := byLoop[maxLoops+1]
+	delete(byLoop, maxLoops+1)
+	d.byLoop = byLoop
+	if over <= 0 {
+		return d
+	}
+
+	if !b.looping && !b.looped {
+		b.emit("loop-limit", fmt.Sprintf("requests to %s went around a cycle %d times; failing them", d.to.ID(), maxLoops))
+	}
+	b.looping = true
+	b.unroutable(over)
+	keep := math.Max(0, d.rps-over) / d.rps
+	for c := range d.byClass {
+		d.byClass[c] *= keep
+	}
+	d.rps -= over
+	return d
+}
+
+// latencyOf returns n.CurrentLatency(). Nodes estimate their latency from
+// their downstream's, so on a cycle the walk stops where it comes back
+// around, counting nothing for the repeated part.
+func latencyOf(n Node) float64 {
+	b := baseOf(n)
+	if b.visiting {
+		return 0
+	}
+	b.visiting = true
+	defer func() { b.visiting = false }()
+	return n.CurrentLatency()
+}
+
+// Settle combines this node's local latency with the end-to-end latency of
+// each downstream node it forwarded to (for a back edge, as of the last
+// tick). Requests completed here without being forwarded (cache hits, sinks)
+// only pay the local latency. Failures add up
+// the same way: local drops, errors, forwarded requests that failed
+// downstream, and requests that outlived TimeoutMs.
+func (b *BaseNode) Settle() {
+	b.downFailed = 0
+	b.timedOut = 0
+	b.errors = b.served * b.errorRate()
+	b.retrying = 0
+	b.setFailed(b.lost + b.errors)
+	if b.localLatency.Empty() {
+		b.latency = LatencyDist{}
+		return
+	}
+	if extra := b.extraLatency(); extra > 0 {
+		b.localLatency = b.localLatency.Then(PointLatency(extra))
+	}
+
+	var parts []LatencyDist
+	var weights []float64
+	var forwarded float64
+	seen := make(map[string]bool)
+	for _, n := range b.DownstreamNodes {
+		w := b.sent[n.ID()]
+		if w <= 0 || seen[n.ID()] {
+			continue
+		}
+		seen[n.ID()] = true
+		ps, ws, failed := b.downstreamParts(n, w)
+		b.downFailed += failed
+		parts = append(parts, ps...)
+		weights = append(weights, ws...)
+		for _, v := range ws {
+			forwarded += v
+		}
+	}
+	if rest := b.served - forwarded; rest > 0 || len(parts) == 0 {
+		parts = append(parts, PointLatency(0))
+		weights = append(weights, math.Max(rest, 1))
+	}
+	b.latency = b.localLatency.Then(MixLatency(parts, weights))
+
+	if b.TimeoutMs > 0 {
+		succeeded := math.Max(0, b.served-b.downFailed)
+		b.timedOut = succeeded * b.latency.FractionAbove(b.TimeoutMs)
+		b.latency = b.latency.Clip(b.TimeoutMs)
+	}
+	b.setFailed(b.lost + b.errors + b.pathFailed())
+}
+
+// failRateFrom returns the share of requests source sent to n that failed.
+// Most nodes treat every sender alike; those that don't (gateway quotas)
+// report it per sender.
+func failRateFrom(n Node, source string) float64 {
+	if t, ok := n.(interface{ failRateFor(string) float64 }); ok {
+		return t.failRateFor(source)
+	}
+	return n.FailRate()
+}
+
+// pathFailed returns the requests that failed downstream or timed out, not
+// counting those that already failed with an error here.
+func (b *BaseNode) pathFailed() float64 {
+	return (b.downFailed + b.timedOut) * (1 - b.errorRate())
+}
+
+// setFailed records how many requests entering this node this tick failed.
+func (b *BaseNode) setFailed(failed float64) {
+	b.failed = failed
+	b.failRate = 0
+	if handled := b.served + b.lost; handled > 0 {
+		b.failRate = math.Min(1, failed/handled)
+	}
+}
+
+// fillMetrics adds the metrics every node shares to m.
+func (b *BaseNode) fillMetrics(m *NodeMetrics) {
+	m.LatencySummary = b.latency.Summary()
+	m.TimedOut = b.timedOut
+	m.FailRate = b.failRate
+	m.Errors = b.errors
+	m.Succeeded, m.Failed = b.outcomes()
+	m.SuccessRate = successRate(m.Succeeded, m.Failed)
+	b.fillClassMetrics(m)
+	if b.Degraded != nil && !b.Down {
+		m.Degraded = b.Degraded.kind()
+		// A gray failure looks fine from the outside.
+		if !b.Degraded.Gray && m.Status != "overloaded" {
+			m.Status = "degraded"
+		}
+	}
+}
+
+// outcomes returns how many requests entering this node this tick succeeded
+// and failed end-to-end. Requests that will be retried are neither yet.
+func (b *BaseNode) outcomes() (succeeded, failed float64) {
+	failed = math.Min(b.failed, b.served+b.lost)
+	succeeded = math.Max(0, b.served+b.lost-failed-b.retrying)
+	return succeeded, failed
+}
+
+// successRate returns the share of finished requests that succeeded (1 when
+// nothing finished).
+func successRate(succeeded, failed float64) float64 {
+	if succeeded+failed <= 0 {
+		return 1
+	}
+	return succeeded / (succeeded + failed)
+}
+
 // StatusFromUtilization returns a health status string.
 // It considers both utilization and queue depth for a realistic assessment:
 // - "overloaded": queue is growing (can't keep up with demand)
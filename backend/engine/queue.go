@@ -0,0 +1,235 @@
+package engine
+
+import "math"
+
+// Queue models a message broker (Kafka/SQS-style) that decouples producers
+// from consumers. Producers publish into a durable backlog and are acknowledged
+// immediately; downstream consumers pull from the backlog at their own pace,
+// so bursts are levelled out instead of being dropped.
+type Queue struct {
+	BaseNode
+	IngestRPS      float64 // max publish rate per second (0 = unlimited)
+	PullRPS        float64 // total consumer pull rate per second (0 = derived from consumer headroom)
+	RetentionLimit float64 // max messages kept in the backlog (0 = unlimited)
+	BaseLatency    float64 // publish/ack latency in ms
+
+	backlogRead  float64
+	backlogWrite float64
+	pullRate     float64 // consumer pull capacity of the last tick
+	throughput   float64
+	readTP       float64
+	writeTP      float64
+	published    float64
+	dropped      float64 // rejected + expired THIS tick, per second
+	totalDropped float64 // messages lost since start
+}
+
+// NewQueue creates a new Queue node.
+func NewQueue(id, label string) *Queue {
+	return &Queue{
+		BaseNode: BaseNode{
+			NodeID:    id,
+			NodeType:  "queue",
+			NodeLabel: label,
+		},
+		BaseLatency: 5,
+	}
+}
+
+// Backlog returns the number of messages waiting to be consumed.
+func (q *Queue) Backlog() float64 {
+	return q.backlogRead + q.backlogWrite
+}
+
+// consumerPull returns the rate each consumer is willing to pull this tick.
+// Without an explicit PullRPS a consumer pulls its spare capacity, i.e. its
+// MaxRPS minus what it needs to work off its own queue. Consumers with no
+// capacity limit (routers, other queues) pull everything.
+func (q *Queue) consumerPull(consumers []Node) []float64 {
+	pull := make([]float64, len(consumers))
+	if q.PullRPS > 0 {
+		for i := range consumers {
+			pull[i] = q.PullRPS / float64(len(consumers))
+		}
+		return pull
+	}
+	for i, n := range consumers {
+		if n.MaxRPS() <= 0 {
+			pull[i] = math.Inf(1)
+			continue
+		}
+		pull[i] = math.Max(0, n.MaxRPS()-n.GetMetrics().QueueDepth/q.tickSeconds())
+	}
+	return pull
+}
+
+// Process appends published messages to the backlog, enforces the retention
+// limit, and hands messages to healthy consumers at their pull rate.
+func (q *Queue) Process() {
+	if q.Down {
+		q.throughput = 0
+		q.readTP = 0
+		q.writeTP = 0
+		q.published = 0
+		q.dropped = 0
+		q.failIncoming()
+		return
+	}
+
+	inRead := q.IncomingRead
+	inWrite := q.IncomingWrite
+	inTotal := q.Incoming + inRead + inWrite
+	q.ResetIncoming()
+
+	// Messages published without a kind are treated as writes (events/jobs).
+	if inTotal > 0 && inRead == 0 && inWrite == 0 {
+		inWrite = inTotal
+	}
+
+	// Ingest limit: anything above the publish rate is rejected at the broker.
+	q.dropped = 0
+	accepted := inTotal
+	if ingest := q.derate(q.IngestRPS); q.IngestRPS > 0 && inTotal > ingest {
+		accepted = ingest
+		q.dropped += inTotal - accepted
+	}
+	q.lost = inTotal - accepted
+	q.served = accepted
+	if inTotal > 0 {
+		ratio := accepted / inTotal
+		inRead *= ratio
+		inWrite *= ratio
+	}
+	q.published = accepted
+	q.localLatency = PointLatency(q.BaseLatency)
+	dt := q.tickSeconds()
+	q.backlogRead += inRead * dt
+	q.backlogWrite += inWrite * dt
+
+	// Retention limit: the oldest messages expire once the backlog is full.
+	backlog := q.Backlog()
+	if q.RetentionLimit > 0 && backlog > q.RetentionLimit {
+		expired := backlog - q.RetentionLimit
+		keep := q.RetentionLimit / backlog
+		q.backlogRead *= keep
+		q.backlogWrite *= keep
+		q.dropped += expired / dt
+		backlog = q.RetentionLimit
+	}
+	q.totalDropped += q.dropped * dt
+
+	q.throughput = 0
+	q.readTP = 0
+	q.writeTP = 0
+	q.pullRate = 0
+
+	var consumers []Node
+	for _, node := range q.Downstream() {
+		// Consumers cut off by a partition can't pull.
+		if !node.IsDown() && q.reaches(node) {
+			consumers = append(consumers, node)
+		}
+	}
+	if len(consumers) == 0 || backlog <= 0 {
+		return
+	}
+
+	readShare := q.backlogRead / backlog
+	pull := q.consumerPull(consumers)
+	for i, node := range consumers {
+		q.pullRate += pull[i]
+		remaining := q.Backlog()
+		if remaining <= 0 {
+			break
+		}
+		delivered := math.Floor(math.Min(pull[i], remaining/dt) + 0.5)
+		if delivered > remaining/dt {
+			delivered = remaining / dt
+		}
+		if delivered <= 0 {
+			continue
+		}
+		reads := delivered * readShare
+		writes := delivered - reads
+		q.forward(node, reads, false)
+		q.forward(node, writes, true)
+		q.backlogRead = math.Max(0, q.backlogRead-reads*dt)
+		q.backlogWrite = math.Max(0, q.backlogWrite-writes*dt)
+		q.readTP += reads
+		q.writeTP += writes
+		q.throughput += delivered
+	}
+}
+
+// ConsumerLag returns how long (ms) a newly published message waits before
+// a consumer pulls it, given the current backlog and pull rate.
+func (q *Queue) ConsumerLag() float64 {
+	backlog := q.Backlog()
+	if backlog <= 0 {
+		return 0
+	}
+	rate := q.pullRate
+	if math.IsInf(rate, 1) {
+		return 0
+	}
+	if rate <= 0 {
+		rate = 1 // no consumers: lag grows with the backlog
+	}
+	return (backlog / rate) * 1000.0
+}
+
+// Settle only reports the publish latency and ingest rejections: producers
+// don't wait for consumers, so nothing downstream affects them.
+func (q *Queue) Settle() {
+	q.latency = q.localLatency
+	if extra := q.extraLatency(); extra > 0 && !q.latency.Empty() {
+		q.latency = q.latency.Then(PointLatency(extra))
+	}
+	q.downFailed = 0
+	q.timedOut = 0
+	q.errors = q.served * q.errorRate()
+	q.retrying = 0
+	q.setFailed(q.lost + q.errors)
+}
+
+// CurrentLatency is the producer-visible latency: publishing is asynchronous,
+// so downstream processing time is not included.
+func (q *Queue) CurrentLatency() float64 {
+	return q.BaseLatency
+}
+
+func (q *Queue) GetMetrics() NodeMetrics {
+	util := 0.0
+	if q.RetentionLimit > 0 {
+		util = math.Min(q.Backlog()/q.RetentionLimit, 1.0)
+	}
+	return NodeMetrics{
+		ID:              q.NodeID,
+		Type:            q.NodeType,
+		Label:           q.NodeLabel,
+		Utilization:     util,
+		Latency:         latencyOf(q),
+		QueueDepth:      q.Backlog(),
+		ReadThroughput:  q.readTP,
+		WriteThroughput: q.writeTP,
+		Throughput:      q.throughput,
+		Dropped:         q.totalDropped,
+		DropRate:        q.dropped,
+		Status:          StatusFromUtilization(util, 0, q.Down),
+		ArrivalRead:     q.lastArrivalR,
+		ArrivalWrite:    q.lastArrivalW,
+		ArrivalTotal:    q.lastArrivalT,
+		Backlog:         q.Backlog(),
+		ConsumerLag:     q.ConsumerLag(),
+	}
+}
+
+func (q *Queue) MaxRPS() float64 {
+	return q.IngestRPS
+}
+
+func (q *Queue) ResetQueues() {
+	q.backlogRead = 0
+	q.backlogWrite = 0
+	q.throughput = 0
+}
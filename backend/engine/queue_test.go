@@ -0,0 +1,80 @@
+package engine
+
+import "testing"
+
+// queued is client c publishing 200 rps -> queue q -> app server worker.
+func queued(configure func(*NodeConfig)) *ArchitectureConfig {
+	config := &ArchitectureConfig{
+		Seed: 1,
+		Nodes: []NodeConfig{
+			{ID: "c", Type: "client", RPS: 200},
+			{ID: "q", Type: "queue", PullRPS: 100},
+			{ID: "worker", Type: "appserver", MaxRPS: 1000, ConcurrencyLimit: 1000},
+		},
+		Edges: []EdgeConfig{{Source: "c", Target: "q"}, {Source: "q", Target: "worker"}},
+	}
+	if configure != nil {
+		setNode(config, "q", configure)
+	}
+	return config
+}
+
+// Producers are acknowledged at once; consumers fall behind at their own pace.
+func TestQueueLevelsBursts(t *testing.T) {
+	r := run(t, queued(nil), 10)
+	for _, tick := range []int{1, 5, 10} {
+		q := nodeAt(t, r, tick, "q")
+		if want := 100 * float64(tick); !near(q.Backlog, want, 1e-6) {
+			t.Errorf("tick %d: backlog %v, want %v", tick, q.Backlog, want)
+		}
+		if want := 1000 * float64(tick); !near(q.ConsumerLag, want, 1e-6) {
+			t.Errorf("tick %d: consumer lag %vms, want %v", tick, q.ConsumerLag, want)
+		}
+		if w := nodeAt(t, r, tick, "worker").Throughput; !near(w, 100, 1e-6) {
+			t.Errorf("tick %d: worker pulled %v rps, want 100", tick, w)
+		}
+	}
+	if r.Summary.SuccessRate != 1 {
+		t.Errorf("success rate %v, want every publish acknowledged", r.Summary.SuccessRate)
+	}
+}
+
+// Without a pull rate, consumers pull what they have spare.
+func TestQueuePullsConsumerHeadroom(t *testing.T) {
+	config := queued(func(nc *NodeConfig) { nc.PullRPS = 0 })
+	setNode(config, "worker", func(nc *NodeConfig) { nc.MaxRPS = 150 })
+	r := run(t, config, 10)
+	if w := nodeAt(t, r, 10, "worker"); !near(w.Throughput, 150, 1e-6) || w.QueueDepth != 0 {
+		t.Errorf("worker pulled %v rps with %v queued, want 150 and nothing queued", w.Throughput, w.QueueDepth)
+	}
+	if q := nodeAt(t, r, 10, "q"); !near(q.Backlog, 500, 1e-6) {
+		t.Errorf("backlog %v, want 500", q.Backlog)
+	}
+}
+
+// Past the retention limit the oldest messages expire; producers never see it.
+// The limit applies before consumers pull, so 400 are left at the end of a tick.
+func TestQueueRetention(t *testing.T) {
+	r := run(t, queued(func(nc *NodeConfig) { nc.RetentionLimit = 500 }), 10)
+	if q := nodeAt(t, r, 4, "q"); q.Backlog != 400 || q.DropRate != 0 {
+		t.Errorf("tick 4: backlog %v expiring %v/s, want 400 and none", q.Backlog, q.DropRate)
+	}
+	q := nodeAt(t, r, 10, "q")
+	if q.Backlog != 400 || !near(q.DropRate, 100, 1e-6) || !near(q.Dropped, 600, 1e-6) {
+		t.Errorf("backlog %v expiring %v/s (%v in all), want 400, 100 and 600", q.Backlog, q.DropRate, q.Dropped)
+	}
+	if r.Summary.SuccessRate != 1 {
+		t.Errorf("success rate %v, want expiry invisible to producers", r.Summary.SuccessRate)
+	}
+}
+
+// Publishes above the ingest rate are rejected at the broker.
+func TestQueueIngestLimit(t *testing.T) {
+	r := run(t, queued(func(nc *NodeConfig) { nc.MaxRPS = 150 }), 10)
+	if !near(r.Summary.SuccessRate, 0.75, 1e-9) {
+		t.Errorf("success rate %v, want 150 of 200 accepted", r.Summary.SuccessRate)
+	}
+	if q := nodeAt(t, r, 10, "q"); !near(q.Backlog, 500, 1e-6) {
+		t.Errorf("backlog %v, want 50 more every second", q.Backlog)
+	}
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"math"
+	"math/rand"
+)
+
+// seedRand gives the node its own random stream. Each node's stream is derived
+// from the graph seed and its ID, so adding a node doesn't change the numbers
+// every other node draws.
+func (b *BaseNode) seedRand(seed int64) {
+	b.rng = rand.New(rand.NewSource(seed ^ int64(hashKey(b.NodeID))))
+}
+
+// random returns the node's random stream, seeding it from the node ID if the
+// node was created outside BuildGraphFromConfig.
+func (b *BaseNode) random() *rand.Rand {
+	if b.rng == nil {
+		b.seedRand(0)
+	}
+	return b.rng
+}
+
+// samplePoisson draws a Poisson-distributed count with the given mean.
+// Large means use the normal approximation.
+func samplePoisson(rng *rand.Rand, mean float64) float64 {
+	if mean <= 0 {
+		return 0
+	}
+	if mean > 30 {
+		return math.Max(0, math.Floor(mean+rng.NormFloat64()*math.Sqrt(mean)+0.5))
+	}
+	limit := math.Exp(-mean)
+	k := 0.0
+	for p := rng.Float64(); p > limit; p *= rng.Float64() {
+		k++
+	}
+	return k
+}
+
+// samplePareto draws a heavy-tailed value with the given mean and shape
+// (alpha > 1; smaller is burstier). Draws are capped at 20x the mean so a
+// single tick can't swamp the whole run.
+func samplePareto(rng *rand.Rand, mean, shape float64) float64 {
+	if mean <= 0 {
+		return 0
+	}
+	if shape <= 1 {
+		shape = 1.5
+	}
+	scale := mean * (shape - 1) / shape
+	u := 1 - rng.Float64() // (0, 1]
+	return math.Min(scale/math.Pow(u, 1/shape), mean*20)
+}
+
+// sampleCapacity returns this tick's capacity (requests per second) for a
+// server whose per-request service time has coefficient of variation cv.
+// Completions over a tick of dt seconds add up, so the relative spread shrinks
+// with the square root of the requests completed.
+func sampleCapacity(rng *rand.Rand, capacity, cv, dt float64) float64 {
+	if cv <= 0 || capacity <= 0 {
+		return capacity
+	}
+	spread := cv / math.Sqrt(math.Max(1, capacity*dt))
+	return capacity * math.Max(0, 1+rng.NormFloat64()*spread)
+}
@@ -0,0 +1,216 @@
+package engine
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Removed-node policies for live graph updates.
+const (
+	RemoveDiscard = "discard" // queued work of removed nodes is dropped
+	RemoveDrain   = "drain"   // removed nodes keep working until their queues are empty
+)
+
+// reconcile merges a freshly built graph into the running one so a live edit
+// doesn't reset the simulation:
+//   - nodes whose ID and type survive are kept with their queues, counters,
+//     faults and DOWN status; if their configuration changed, the new
+//     parameters are applied in place (a degradation only if the edit
+//     changes it);
+//   - new nodes start empty;
+//   - removed nodes lose their queued work, or with RemoveDrain keep running,
+//     with no inbound edges, until it's done.
+//
+// It returns the merged graph and the changes to report.
+func reconcile(old, fresh *Graph, onRemove string) (*Graph, []Event) {
+	var events []Event
+	merged := make(map[string]Node, len(fresh.Nodes))
+	for _, id := range sortedIDs(fresh.Nodes) {
+		n := fresh.Nodes[id]
+		prev, ok := old.Nodes[id]
+		switch {
+		case !ok:
+			events = append(events, Event{NodeID: id, Type: "node-added", Message: "new node starts empty"})
+			merged[id] = n
+		case prev.Type() != n.Type():
+			events = append(events, Event{NodeID: id, Type: "node-replaced", Message: fmt.Sprintf("%s replaced by %s; state discarded", prev.Type(), n.Type())})
+			merged[id] = n
+		default:
+			if oc, nc := old.configs[id], fresh.configs[id]; !reflect.DeepEqual(oc, nc) {
+				role := false
+				if db, ok := prev.(*Database); ok {
+					role = db.IsReplica
+				}
+				reconfigure(prev, n)
+				if db, ok := prev.(*Database); ok && oc.IsReplica == nc.IsReplica {
+					// Keep roles changed by a failover unless the edit sets one.
+					db.IsReplica = role
+				}
+				if !reflect.DeepEqual(oc.Degradation, nc.Degradation) {
+					// Otherwise keep one applied at runtime (chaos, degrade).
+					baseOf(prev).Degraded = baseOf(n).Degraded
+				}
+				events = append(events, Event{NodeID: id, Type: "node-reconfigured", Message: "new settings applied in place"})
+			}
+			if lb, ok := prev.(*LoadBalancer); ok {
+				// Edge weights live on the load balancer.
+				lb.Weights = n.(*LoadBalancer).Weights
+			}
+			merged[id] = prev
+		}
+	}
+
+	// Removed nodes: drain (they keep their old downstream, as far as it still
+	// exists) or discard.
+	var draining []Node
+	for _, n := range old.Sorted {
+		if _, ok := fresh.Nodes[n.ID()]; ok {
+			continue
+		}
+		backlog := n.GetMetrics().QueueDepth
+		switch {
+		case backlog <= 0 || n.IsDown():
+			events = append(events, Event{NodeID: n.ID(), Type: "node-removed", Message: "removed"})
+		case onRemove == RemoveDrain:
+			events = append(events, Event{NodeID: n.ID(), Type: "node-draining", Message: fmt.Sprintf("removed; draining %.0f queued requests", backlog)})
+			draining = append(draining, n)
+			merged[n.ID()] = n
+		default:
+			events = append(events, Event{NodeID: n.ID(), Type: "node-removed", Message: fmt.Sprintf("removed; %.0f queued requests discarded", backlog)})
+		}
+	}
+
+	// Rewire every kept node to the merged nodes.
+	for id, n := range fresh.Nodes {
+		merged[id].SetDownstream(remap(n.Downstream(), merged))
+	}
+	for _, n := range draining {
+		n.SetDownstream(remap(n.Downstream(), merged))
+	}
+
+	// Requests in flight over back edges arrive at the merged nodes, or are
+	// dropped with their target.
+	for _, n := range merged {
+		b := baseOf(n)
+		var deferred []delivery
+		for _, d := range b.deferred {
+			if to, ok := merged[d.to.ID()]; ok {
+				d.to = to
+				deferred = append(deferred, d)
+			}
+		}
+		b.deferred = deferred
+	}
+
+	sorted := remap(fresh.Sorted, merged)
+	graph := *fresh
+	graph.Nodes = merged
+	graph.Sorted = append(draining, sorted...)
+	markBackEdges(graph.Sorted)
+	graph.shareClasses()
+	graph.EntryNode = merged[fresh.EntryNode.ID()]
+	graph.Entries = remap(fresh.Entries, merged)
+	graph.draining = make(map[string]bool, len(draining))
+	for _, n := range draining {
+		graph.draining[n.ID()] = true
+	}
+	return &graph, events
+}
+
+// remap swaps nodes for the merged nodes with the same ID, dropping those
+// that no longer exist.
+func remap(nodes []Node, merged map[string]Node) []Node {
+	var out []Node
+	for _, n := range nodes {
+		if m, ok := merged[n.ID()]; ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// finishDrains removes draining nodes whose queues are empty, and reports
+// them.
+func (g *Graph) finishDrains() []Event {
+	var events []Event
+	for _, n := range g.Sorted {
+		if !g.draining[n.ID()] || (!n.IsDown() && n.GetMetrics().QueueDepth > 0) {
+			continue
+		}
+		delete(g.draining, n.ID())
+		delete(g.Nodes, n.ID())
+		events = append(events, Event{NodeID: n.ID(), Type: "node-drained", Message: "queue empty; node removed"})
+	}
+	if len(events) > 0 {
+		g.Sorted = remap(g.Sorted, g.Nodes)
+	}
+	return events
+}
+
+// reconfigure applies the settings of a freshly built node to a running node
+// of the same type, keeping its runtime state.
+func reconfigure(node, fresh Node) {
+	b, f := baseOf(node), baseOf(fresh)
+	b.NodeLabel = f.NodeLabel
+	b.TimeoutMs = f.TimeoutMs
+	b.ErrorRate = f.ErrorRate
+	b.arrivalVar = f.arrivalVar
+
+	switch n := node.(type) {
+	case *Client:
+		c := fresh.(*Client)
+		n.RPS, n.ReadRatio = c.RPS, c.ReadRatio
+		n.Arrival, n.ParetoShape = c.Arrival, c.ParetoShape
+		n.OnSeconds, n.OffSeconds = c.OnSeconds, c.OffSeconds
+		n.retry.Policy = c.retry.Policy
+		n.Classes = c.Classes
+	case *AppServer:
+		s := fresh.(*AppServer)
+		n.BaseLatency, n.ServiceCV = s.BaseLatency, s.ServiceCV
+		n.ConcurrencyLimit = s.ConcurrencyLimit
+		n.retry.Policy = s.retry.Policy
+		n.health.Policy = s.health.Policy
+		n.scaling.Policy = s.scaling.Policy
+		n.scaling.InstanceRPS = s.scaling.InstanceRPS
+		if n.scaling.enabled() && n.scaling.started {
+			n.CapacityRPS = n.scaling.capacity()
+		} else {
+			n.CapacityRPS = s.CapacityRPS
+		}
+	case *Database:
+		d := fresh.(*Database)
+		n.CapacityRPS, n.BaseLatency, n.ServiceCV = d.CapacityRPS, d.BaseLatency, d.ServiceCV
+		n.ConcurrencyLimit = d.ConcurrencyLimit
+		n.IsReplica = d.IsReplica
+	case *LoadBalancer:
+		lb := fresh.(*LoadBalancer)
+		n.CapacityRPS, n.Algorithm = lb.CapacityRPS, lb.Algorithm
+		n.health.Policy = lb.health.Policy
+	case *DBRouter:
+		r := fresh.(*DBRouter)
+		n.ReadRatio, n.MaxLagMs = r.ReadRatio, r.MaxLagMs
+		n.health.Policy = r.health.Policy
+		n.failover.Policy = r.failover.Policy
+	case *Cache:
+		c := fresh.(*Cache)
+		n.CapacityRPS, n.BaseLatency, n.ServiceCV = c.CapacityRPS, c.BaseLatency, c.ServiceCV
+		n.HitRatio, n.WriteMode = c.HitRatio, c.WriteMode
+		n.WarmupSeconds, n.EvictionRate = c.WarmupSeconds, c.EvictionRate
+	case *Queue:
+		q := fresh.(*Queue)
+		n.IngestRPS, n.PullRPS = q.IngestRPS, q.PullRPS
+		n.RetentionLimit, n.BaseLatency = q.RetentionLimit, q.BaseLatency
+	case *CircuitBreaker:
+		cb := fresh.(*CircuitBreaker)
+		n.ErrorThreshold, n.LatencyThresholdMs = cb.ErrorThreshold, cb.LatencyThresholdMs
+		n.OpenSeconds, n.ProbeRatio, n.MinRequests = cb.OpenSeconds, cb.ProbeRatio, cb.MinRequests
+	case *Gateway:
+		g := fresh.(*Gateway)
+		n.RateLimit, n.Mode, n.BaseLatency = g.RateLimit, g.Mode, g.BaseLatency
+		if g.Burst != n.Burst {
+			n.Burst = g.Burst
+			n.tokens = g.tokens
+		}
+		n.Quotas = g.Quotas
+	}
+}
@@ -0,0 +1,287 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+// reconcileConfig is client c -> appserver api -> database db.
+func reconcileConfig() *ArchitectureConfig {
+	return &ArchitectureConfig{
+		Seed: 1,
+		Nodes: []NodeConfig{
+			{ID: "c", Type: "client", RPS: 100},
+			{ID: "api", Type: "appserver", MaxRPS: 100},
+			{ID: "db", Type: "database", MaxRPS: 50},
+		},
+		Edges: []EdgeConfig{
+			{Source: "c", Target: "api"},
+			{Source: "api", Target: "db"},
+		},
+	}
+}
+
+func mustBuild(t *testing.T, config *ArchitectureConfig) *Graph {
+	t.Helper()
+	g, err := BuildGraphFromConfig(config)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	return g
+}
+
+// removeNode drops a node and its edges from a config.
+func removeNode(config *ArchitectureConfig, id string) {
+	var nodes []NodeConfig
+	for _, nc := range config.Nodes {
+		if nc.ID != id {
+			nodes = append(nodes, nc)
+		}
+	}
+	var edges []EdgeConfig
+	for _, e := range config.Edges {
+		if e.Source != id && e.Target != id {
+			edges = append(edges, e)
+		}
+	}
+	config.Nodes, config.Edges = nodes, edges
+}
+
+func setNode(config *ArchitectureConfig, id string, set func(*NodeConfig)) {
+	for i := range config.Nodes {
+		if config.Nodes[i].ID == id {
+			set(&config.Nodes[i])
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	half := 0.5
+	tests := []struct {
+		name     string
+		onRemove string
+		dbQueue  float64                   // db backlog before the edit
+		before   func(old *Graph)          // runtime changes before the edit
+		edit     func(*ArchitectureConfig) // the live edit
+		events   map[string]string         // node ID -> event type
+		check    func(t *testing.T, old, merged *Graph)
+	}{
+		{
+			name:   "unchanged node is kept as is",
+			edit:   func(*ArchitectureConfig) {},
+			events: map[string]string{},
+			check: func(t *testing.T, old, merged *Graph) {
+				if merged.Nodes["api"] != old.Nodes["api"] {
+					t.Error("api was rebuilt")
+				}
+				if q := merged.Nodes["api"].(*AppServer).queueDepth; q != 40 {
+					t.Errorf("api queue = %v, want 40", q)
+				}
+			},
+		},
+		{
+			name: "reconfigured node keeps its state",
+			edit: func(c *ArchitectureConfig) {
+				setNode(c, "api", func(nc *NodeConfig) { nc.MaxRPS = 200 })
+			},
+			events: map[string]string{"api": "node-reconfigured"},
+			check: func(t *testing.T, old, merged *Graph) {
+				api := merged.Nodes["api"].(*AppServer)
+				if api != old.Nodes["api"] {
+					t.Error("api was rebuilt")
+				}
+				if api.CapacityRPS != 200 || api.queueDepth != 40 {
+					t.Errorf("api capacity %v queue %v, want 200 and 40", api.CapacityRPS, api.queueDepth)
+				}
+			},
+		},
+		{
+			name: "node with a new type is replaced",
+			edit: func(c *ArchitectureConfig) {
+				setNode(c, "api", func(nc *NodeConfig) { nc.Type = "cache" })
+			},
+			events: map[string]string{"api": "node-replaced"},
+			check: func(t *testing.T, old, merged *Graph) {
+				if _, ok := merged.Nodes["api"].(*Cache); !ok {
+					t.Errorf("api is %T, want *Cache", merged.Nodes["api"])
+				}
+				if d := merged.Nodes["c"].Downstream(); len(d) != 1 || d[0] != merged.Nodes["api"] {
+					t.Error("c isn't wired to the new api")
+				}
+			},
+		},
+		{
+			name: "added node starts empty",
+			edit: func(c *ArchitectureConfig) {
+				c.Nodes = append(c.Nodes, NodeConfig{ID: "cache", Type: "cache"})
+				c.Edges = append(c.Edges, EdgeConfig{Source: "api", Target: "cache"})
+			},
+			events: map[string]string{"cache": "node-added"},
+			check: func(t *testing.T, old, merged *Graph) {
+				if len(merged.Nodes["api"].Downstream()) != 2 {
+					t.Error("api isn't wired to cache")
+				}
+			},
+		},
+		{
+			name:    "removed node's queue is discarded",
+			dbQueue: 10,
+			edit:    func(c *ArchitectureConfig) { removeNode(c, "db") },
+			events:  map[string]string{"db": "node-removed"},
+			check: func(t *testing.T, old, merged *Graph) {
+				if _, ok := merged.Nodes["db"]; ok {
+					t.Error("db still in the graph")
+				}
+				if len(merged.Nodes["api"].Downstream()) != 0 {
+					t.Error("api still sends to db")
+				}
+			},
+		},
+		{
+			name:     "removed node drains its queue",
+			onRemove: RemoveDrain,
+			dbQueue:  10,
+			edit:     func(c *ArchitectureConfig) { removeNode(c, "db") },
+			events:   map[string]string{"db": "node-draining"},
+			check: func(t *testing.T, old, merged *Graph) {
+				if merged.Nodes["db"] != old.Nodes["db"] || !merged.draining["db"] {
+					t.Fatal("db isn't draining")
+				}
+				if len(merged.Nodes["api"].Downstream()) != 0 {
+					t.Error("api still sends to db")
+				}
+				if events := merged.finishDrains(); len(events) != 0 {
+					t.Errorf("db finished draining with a queue: %v", events)
+				}
+				merged.Nodes["db"].(*Database).queueDepth = 0
+				if events := merged.finishDrains(); len(events) != 1 || events[0].Type != "node-drained" {
+					t.Errorf("finishDrains = %v, want node-drained", events)
+				}
+				if _, ok := merged.Nodes["db"]; ok {
+					t.Error("drained db still in the graph")
+				}
+			},
+		},
+		{
+			name:     "removed node with an empty queue goes at once",
+			onRemove: RemoveDrain,
+			edit:     func(c *ArchitectureConfig) { removeNode(c, "db") },
+			events:   map[string]string{"db": "node-removed"},
+			check: func(t *testing.T, old, merged *Graph) {
+				if _, ok := merged.Nodes["db"]; ok {
+					t.Error("db still in the graph")
+				}
+			},
+		},
+		{
+			name: "runtime degradation survives an unrelated edit",
+			before: func(old *Graph) {
+				baseOf(old.Nodes["api"]).Degraded = &Degradation{Capacity: &half}
+			},
+			edit: func(c *ArchitectureConfig) {
+				setNode(c, "api", func(nc *NodeConfig) { nc.MaxRPS = 200 })
+			},
+			events: map[string]string{"api": "node-reconfigured"},
+			check: func(t *testing.T, old, merged *Graph) {
+				if d := baseOf(merged.Nodes["api"]).Degraded; d == nil || *d.Capacity != half {
+					t.Errorf("degradation = %+v, want the runtime one", d)
+				}
+			},
+		},
+		{
+			name: "edited degradation replaces the runtime one",
+			before: func(old *Graph) {
+				baseOf(old.Nodes["api"]).Degraded = &Degradation{Capacity: &half}
+			},
+			edit: func(c *ArchitectureConfig) {
+				setNode(c, "api", func(nc *NodeConfig) { nc.Degradation = &Degradation{LatencyMs: 100} })
+			},
+			events: map[string]string{"api": "node-reconfigured"},
+			check: func(t *testing.T, old, merged *Graph) {
+				if d := baseOf(merged.Nodes["api"]).Degraded; d == nil || d.LatencyMs != 100 || d.Capacity != nil {
+					t.Errorf("degradation = %+v, want the edited one", d)
+				}
+			},
+		},
+		{
+			name: "failover role survives an unrelated edit",
+			before: func(old *Graph) {
+				old.Nodes["db"].(*Database).IsReplica = true
+			},
+			edit: func(c *ArchitectureConfig) {
+				setNode(c, "db", func(nc *NodeConfig) { nc.MaxRPS = 80 })
+			},
+			events: map[string]string{"db": "node-reconfigured"},
+			check: func(t *testing.T, old, merged *Graph) {
+				if !merged.Nodes["db"].(*Database).IsReplica {
+					t.Error("db lost its replica role")
+				}
+			},
+		},
+		{
+			name: "in-flight requests follow a replaced node",
+			before: func(old *Graph) {
+				c := baseOf(old.Nodes["c"])
+				c.deferred = []delivery{{to: old.Nodes["api"], rps: 5}, {to: old.Nodes["db"], rps: 3}}
+			},
+			edit: func(c *ArchitectureConfig) {
+				setNode(c, "api", func(nc *NodeConfig) { nc.Type = "cache" })
+				removeNode(c, "db")
+			},
+			events: map[string]string{"api": "node-replaced", "db": "node-removed"},
+			check: func(t *testing.T, old, merged *Graph) {
+				deferred := baseOf(merged.Nodes["c"]).deferred
+				if len(deferred) != 1 || deferred[0].to != merged.Nodes["api"] || deferred[0].rps != 5 {
+					t.Errorf("deferred = %+v, want 5 rps to the new api only", deferred)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := mustBuild(t, reconcileConfig())
+			old.Nodes["api"].(*AppServer).queueDepth = 40
+			old.Nodes["db"].(*Database).queueDepth = tt.dbQueue
+			if tt.before != nil {
+				tt.before(old)
+			}
+			config := reconcileConfig()
+			tt.edit(config)
+			merged, events := reconcile(old, mustBuild(t, config), tt.onRemove)
+
+			got := make(map[string]string)
+			for _, e := range events {
+				got[e.NodeID] = e.Type
+			}
+			if len(got) != len(tt.events) {
+				t.Errorf("events = %v, want %v", got, tt.events)
+			}
+			for id, want := range tt.events {
+				if got[id] != want {
+					t.Errorf("event for %s = %q, want %q", id, got[id], want)
+				}
+			}
+			for id, n := range merged.Nodes {
+				if n.ID() != id {
+					t.Errorf("node %s stored under %s", n.ID(), id)
+				}
+			}
+			if len(merged.Sorted) != len(merged.Nodes) {
+				t.Errorf("%d nodes sorted, %d in the graph", len(merged.Sorted), len(merged.Nodes))
+			}
+			tt.check(t, old, merged)
+		})
+	}
+}
+
+func TestReconcileDiscardMessage(t *testing.T) {
+	old := mustBuild(t, reconcileConfig())
+	old.Nodes["db"].(*Database).queueDepth = 10
+	config := reconcileConfig()
+	removeNode(config, "db")
+	_, events := reconcile(old, mustBuild(t, config), RemoveDiscard)
+	if len(events) != 1 || !strings.Contains(events[0].Message, "10 queued requests discarded") {
+		t.Errorf("events = %v, want the discarded backlog reported", events)
+	}
+}
@@ -0,0 +1,126 @@
+package engine
+
+import "math"
+
+// RetryPolicy describes how a node retries requests that failed or timed out.
+// Backoff is in simulated seconds: attempt k+1 is sent
+// BackoffSeconds*Multiplier^(k-1) seconds after attempt k failed, spread by
+// ±Jitter of that delay and rounded to whole ticks.
+type RetryPolicy struct {
+	MaxAttempts    int     `json:"maxAttempts"`              // total attempts including the first (<= 1 disables retries)
+	BackoffSeconds float64 `json:"backoffSeconds,omitempty"` // delay before the first retry (default 1)
+	Multiplier     float64 `json:"multiplier,omitempty"`     // backoff growth per attempt (default 2)
+	Jitter         float64 `json:"jitter,omitempty"`         // 0.0 to 1.0, fraction of the delay to spread retries over
+	Budget         float64 `json:"budget,omitempty"`         // max retries per tick as a fraction of first attempts (0 = unlimited)
+}
+
+// retrier tracks in-flight retries for a node. Traffic is fluid, so instead
+// of individual requests it keeps how much traffic of each attempt number was
+// sent this tick and how much is scheduled for future ticks.
+type retrier struct {
+	Policy  *RetryPolicy
+	tick    int
+	pending map[int]map[int]float64 // due tick -> attempt -> requests
+	sent    map[int]float64         // attempt -> requests sent this tick
+	retried float64                 // retries sent this tick
+}
+
+// enabled reports whether failed requests are retried at all.
+func (r *retrier) enabled() bool {
+	return r.Policy != nil && r.Policy.MaxAttempts > 1
+}
+
+// next starts a new tick: it records fresh first attempts and returns them
+// plus every retry that is due now.
+func (r *retrier) next(fresh float64) float64 {
+	r.tick++
+	r.sent = map[int]float64{1: fresh}
+	r.retried = 0
+	due := r.pending[r.tick]
+	delete(r.pending, r.tick)
+	for attempt, amount := range due {
+		r.sent[attempt] += amount
+		r.retried += amount
+	}
+	return fresh + r.retried
+}
+
+// schedule takes the requests that failed this tick and schedules retries for
+// those with attempts left and within budget, dt being the tick length in
+// seconds. It returns the requests that failed for good.
+func (r *retrier) schedule(failed, dt float64) float64 {
+	if failed <= 0 {
+		return 0
+	}
+	if !r.enabled() {
+		return failed
+	}
+
+	var total float64
+	for _, amount := range r.sent {
+		total += amount
+	}
+	if total <= 0 {
+		return failed
+	}
+
+	budget := math.Inf(1)
+	if r.Policy.Budget > 0 {
+		budget = r.Policy.Budget * r.sent[1]
+	}
+
+	exhausted := 0.0
+	for attempt := 1; attempt <= r.Policy.MaxAttempts; attempt++ {
+		share := failed * r.sent[attempt] / total
+		if share <= 0 {
+			continue
+		}
+		if attempt >= r.Policy.MaxAttempts {
+			exhausted += share
+			continue
+		}
+		retry := math.Min(share, budget)
+		budget -= retry
+		exhausted += share - retry
+		r.enqueue(attempt+1, retry, dt)
+	}
+	return exhausted
+}
+
+// enqueue spreads a retry of the given attempt number over the ticks covered
+// by its backoff delay and jitter.
+func (r *retrier) enqueue(attempt int, amount, dt float64) {
+	if amount <= 0 {
+		return
+	}
+	base := r.Policy.BackoffSeconds
+	if base <= 0 {
+		base = 1
+	}
+	mult := r.Policy.Multiplier
+	if mult <= 0 {
+		mult = 2
+	}
+	delay := base * math.Pow(mult, float64(attempt-2))
+	jitter := math.Max(0, math.Min(1, r.Policy.Jitter))
+
+	first := int(math.Max(1, float64(ticksFor(delay*(1-jitter), dt))))
+	last := int(math.Max(1, float64(ticksFor(delay*(1+jitter), dt))))
+	per := amount / float64(last-first+1)
+
+	if r.pending == nil {
+		r.pending = make(map[int]map[int]float64)
+	}
+	for t := first; t <= last; t++ {
+		due := r.tick + t
+		if r.pending[due] == nil {
+			r.pending[due] = make(map[int]float64)
+		}
+		r.pending[due][attempt] += per
+	}
+}
+
+// reset drops every scheduled retry.
+func (r *retrier) reset() {
+	r.pending = nil
+}
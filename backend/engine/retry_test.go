@@ -0,0 +1,79 @@
+package engine
+
+import "testing"
+
+// retrying is chain(100) with the client retrying as policy says.
+func retrying(policy *RetryPolicy) *ArchitectureConfig {
+	config := chain(100)
+	setNode(config, "c", func(nc *NodeConfig) { nc.Retry = policy })
+	return config
+}
+
+// With db down for good, every failure is retried until attempts run out: a
+// retry one second later and another two seconds after that triple the load.
+func TestRetriesAmplifyAnOutage(t *testing.T) {
+	config := retrying(&RetryPolicy{MaxAttempts: 3, BackoffSeconds: 1, Multiplier: 2})
+	config.Chaos = &ChaosPlan{Events: []ChaosEvent{{At: 1, Action: "down", Node: "db"}}}
+	r := run(t, config, 10)
+	for _, tt := range []struct {
+		tick    int
+		retries float64
+	}{{1, 0}, {2, 100}, {3, 100}, {4, 200}, {10, 200}} {
+		if got := r.Ticks[tt.tick-1].Clients[0].Retries; !near(got, tt.retries, 1e-6) {
+			t.Errorf("tick %d: %v retries, want %v", tt.tick, got, tt.retries)
+		}
+	}
+	if got := nodeAt(t, r, 10, "api").Throughput; !near(got, 300, 1e-6) {
+		t.Errorf("api got %v rps, want three attempts of 100", got)
+	}
+	if got := r.Ticks[9].Clients[0]; got.InjectedRPS != 100 || !near(got.Failed, 100, 1e-6) {
+		t.Errorf("injected %v and failed %v, want retries kept out of both counts", got.InjectedRPS, got.Failed)
+	}
+}
+
+// A retry budget caps retries at a share of first attempts.
+func TestRetryBudget(t *testing.T) {
+	config := retrying(&RetryPolicy{MaxAttempts: 3, Budget: 0.1})
+	config.Chaos = &ChaosPlan{Events: []ChaosEvent{{At: 1, Action: "down", Node: "db"}}}
+	r := run(t, config, 10)
+	if got := r.Ticks[9].Clients[0].Retries; !near(got, 10, 1e-6) {
+		t.Errorf("%v retries, want 10", got)
+	}
+}
+
+// Retries ride out a blip shorter than the backoff.
+func TestRetriesHideABlip(t *testing.T) {
+	blip := []ChaosEvent{{At: 11, Action: "down", Node: "db", Duration: 1}}
+	config := chain(100)
+	config.Chaos = &ChaosPlan{Events: blip}
+	if failed := run(t, config, 20).Summary.Failed; !near(failed, 100, 1e-6) {
+		t.Fatalf("without retries %v failed, want the 100 sent during the blip", failed)
+	}
+
+	config = retrying(&RetryPolicy{MaxAttempts: 2})
+	config.Chaos = &ChaosPlan{Events: blip}
+	r := run(t, config, 20)
+	if r.Summary.Failed != 0 || !near(r.Summary.Succeeded, 2000, 1e-6) {
+		t.Errorf("succeeded %v and failed %v, want all 2000 through", r.Summary.Succeeded, r.Summary.Failed)
+	}
+	if got := r.Ticks[11].Clients[0].Retries; !near(got, 100, 1e-6) {
+		t.Errorf("%v retries the tick after the blip, want 100", got)
+	}
+}
+
+// Jitter spreads a retry over the ticks its delay can fall in: 2s ±50% is one
+// to three seconds after the failure.
+func TestRetryJitter(t *testing.T) {
+	config := retrying(&RetryPolicy{MaxAttempts: 2, BackoffSeconds: 2, Jitter: 0.5})
+	config.Chaos = &ChaosPlan{Events: []ChaosEvent{{At: 11, Action: "down", Node: "db", Duration: 1}}}
+	r := run(t, config, 20)
+	for tick := 12; tick <= 15; tick++ {
+		want := 100.0 / 3
+		if tick == 15 {
+			want = 0
+		}
+		if got := r.Ticks[tick-1].Clients[0].Retries; !near(got, want, 1e-6) {
+			t.Errorf("tick %d: %v retries, want %v", tick, got, want)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package engine
+
+import (
+	"math"
+	"sort"
+)
+
+// RunResult is the outcome of a headless run: a summary, plus every tick if
+// the series was asked for.
+type RunResult struct {
+	Ticks   []TickResult `json:"ticks,omitempty"`
+	Summary RunSummary   `json:"summary"`
+}
+
+// RunSummary aggregates a whole run. Request counts are totals over the run;
+// latency percentiles are over every request in the run, not averages of
+// per-tick percentiles.
+type RunSummary struct {
+	Ticks       int             `json:"ticks"`
+	SimSeconds  float64         `json:"simSeconds"`
+	Seed        int64           `json:"seed"`
+	AvgTotalRPS float64         `json:"avgTotalRPS"` // new requests per second across all clients
+	Succeeded   float64         `json:"succeeded"`
+	Failed      float64         `json:"failed"`
+	SuccessRate float64         `json:"successRate"`
+	Nodes       []NodeSummary   `json:"nodes"`
+	Clients     []ClientSummary `json:"clients"`
+	Classes     []ClassSummary  `json:"classes,omitempty"`
+	// Bottlenecks lists nodes flagged as bottlenecks in any tick, most
+	// frequent first.
+	Bottlenecks []string `json:"bottleneckIds"`
+}
+
+// NodeSummary aggregates one node's metrics over a run.
+type NodeSummary struct {
+	ID              string  `json:"id"`
+	Type            string  `json:"type"`
+	Label           string  `json:"label"`
+	AvgUtilization  float64 `json:"avgUtilization"`
+	PeakUtilization float64 `json:"peakUtilization"`
+	AvgThroughput   float64 `json:"avgThroughput"` // requests per second
+	PeakQueueDepth  float64 `json:"peakQueueDepth"`
+	Dropped         float64 `json:"dropped"`
+	Succeeded       float64 `json:"succeeded"`
+	Failed          float64 `json:"failed"`
+	SuccessRate     float64 `json:"successRate"`
+	BottleneckTicks int     `json:"bottleneckTicks"`
+	LatencySummary
+}
+
+// ClientSummary is the end-to-end view of one client over a run.
+type ClientSummary struct {
+	ID             string  `json:"id"`
+	Label          string  `json:"label"`
+	AvgInjectedRPS float64 `json:"avgInjectedRPS"` // new requests per second
+	Succeeded      float64 `json:"succeeded"`
+	Failed         float64 `json:"failed"`
+	SuccessRate    float64 `json:"successRate"`
+	LatencySummary
+}
+
+// ClassSummary is the end-to-end view of one request class over a run.
+type ClassSummary struct {
+	Name           string  `json:"name"`
+	AvgInjectedRPS float64 `json:"avgInjectedRPS"`
+	Succeeded      float64 `json:"succeeded"`
+	Failed         float64 `json:"failed"`
+	SuccessRate    float64 `json:"successRate"`
+	LatencySummary
+}
+
+// nodeRun accumulates a node's metrics while a run progresses.
+type nodeRun struct {
+	summary  NodeSummary
+	latency  LatencyDist
+	weight   float64
+	injected float64 // clients: sum of the per-tick injected rates
+}
+
+// RunFor runs graph for the given number of ticks as fast as possible, with
+// no ticker and no live consumer, and returns a summary, plus every tick with
+// series set. The graph's state advances, so build a fresh graph for each run.
+func RunFor(graph *Graph, ticks int, series bool) *RunResult {
+	sim := NewSimulator(graph)
+	sim.quiet = true
+	result := &RunResult{}
+	if series {
+		result.Ticks = make([]TickResult, 0, ticks)
+	}
+
+	runs := make(map[string]*nodeRun, len(graph.Sorted))
+	for _, node := range graph.Sorted {
+		runs[node.ID()] = &nodeRun{}
+	}
+	classes := make(map[string]*classTotal)
+
+	for i := 0; i < ticks; i++ {
+		tr, _ := sim.tick()
+		// Drain the live stream; nobody is listening in a headless run.
+		select {
+		case <-sim.output:
+		default:
+		}
+		if series {
+			result.Ticks = append(result.Ticks, tr)
+		}
+
+		for _, id := range tr.Bottlenecks {
+			if r, ok := runs[id]; ok {
+				r.summary.BottleneckTicks++
+			}
+		}
+		for _, c := range tr.Clients {
+			if r, ok := runs[c.ID]; ok {
+				r.injected += c.InjectedRPS
+			}
+		}
+		for name, t := range sim.classTotals {
+			run, ok := classes[name]
+			if !ok {
+				run = &classTotal{}
+				classes[name] = run
+			}
+			run.injected += t.injected
+			run.succeeded += t.succeeded * tr.TickSeconds
+			run.failed += t.failed * tr.TickSeconds
+			if w := t.weight * tr.TickSeconds; w > 0 {
+				run.latency = MixLatency([]LatencyDist{run.latency, t.latency}, []float64{run.weight, w})
+				run.weight += w
+			}
+		}
+		for _, m := range tr.Nodes {
+			r, ok := runs[m.ID]
+			if !ok {
+				continue
+			}
+			s := &r.summary
+			s.ID, s.Type, s.Label = m.ID, m.Type, m.Label
+			s.AvgUtilization += m.Utilization
+			s.PeakUtilization = math.Max(s.PeakUtilization, m.Utilization)
+			s.AvgThroughput += m.Throughput
+			s.PeakQueueDepth = math.Max(s.PeakQueueDepth, m.QueueDepth)
+			s.Dropped = m.Dropped
+			s.Succeeded += m.Succeeded * tr.TickSeconds
+			s.Failed += m.Failed * tr.TickSeconds
+
+			// Fold this tick's end-to-end latency into the run-wide
+			// distribution, weighted by the requests that saw it.
+			if d := graph.Nodes[m.ID].LatencyDistribution(); !d.Empty() {
+				w := (m.Succeeded + m.Failed) * tr.TickSeconds
+				if w > 0 {
+					r.latency = MixLatency([]LatencyDist{r.latency, d}, []float64{r.weight, w})
+					r.weight += w
+				}
+			}
+		}
+	}
+
+	result.Summary = summarize(graph, sim, runs, ticks)
+	result.Summary.Classes = summarizeClasses(classes, ticks)
+	return result
+}
+
+// summarize turns the accumulated per-node metrics into a RunSummary.
+func summarize(graph *Graph, sim *Simulator, runs map[string]*nodeRun, ticks int) RunSummary {
+	_, _, simTime := sim.Clock()
+	summary := RunSummary{
+		Ticks:      ticks,
+		SimSeconds: simTime,
+		Seed:       graph.Seed,
+	}
+
+	counts := make(map[string]int)
+	for _, node := range graph.Sorted {
+		r := runs[node.ID()]
+		s := r.summary
+		if ticks > 0 {
+			s.AvgUtilization /= float64(ticks)
+			s.AvgThroughput /= float64(ticks)
+		}
+		s.SuccessRate = successRate(s.Succeeded, s.Failed)
+		s.LatencySummary = r.latency.Summary()
+		summary.Nodes = append(summary.Nodes, s)
+
+		if s.BottleneckTicks > 0 {
+			counts[s.ID] = s.BottleneckTicks
+			summary.Bottlenecks = append(summary.Bottlenecks, s.ID)
+		}
+		if s.Type == "client" {
+			injected := 0.0
+			if ticks > 0 {
+				injected = r.injected / float64(ticks)
+			}
+			summary.Clients = append(summary.Clients, ClientSummary{
+				ID:             s.ID,
+				Label:          s.Label,
+				AvgInjectedRPS: injected,
+				Succeeded:      s.Succeeded,
+				Failed:         s.Failed,
+				SuccessRate:    s.SuccessRate,
+				LatencySummary: s.LatencySummary,
+			})
+			summary.AvgTotalRPS += injected
+			summary.Succeeded += s.Succeeded
+			summary.Failed += s.Failed
+		}
+	}
+	summary.SuccessRate = successRate(summary.Succeeded, summary.Failed)
+	sort.SliceStable(summary.Bottlenecks, func(i, j int) bool {
+		return counts[summary.Bottlenecks[i]] > counts[summary.Bottlenecks[j]]
+	})
+	return summary
+}
+
+// summarizeClasses turns the accumulated class totals into summaries, in
+// name order.
+func summarizeClasses(classes map[string]*classTotal, ticks int) []ClassSummary {
+	names := make([]string, 0, len(classes))
+	for name := range classes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var out []ClassSummary
+	for _, name := range names {
+		t := classes[name]
+		s := ClassSummary{
+			Name:           name,
+			Succeeded:      t.succeeded,
+			Failed:         t.failed,
+			SuccessRate:    successRate(t.succeeded, t.failed),
+			LatencySummary: t.latency.Summary(),
+		}
+		if ticks > 0 {
+			s.AvgInjectedRPS = t.injected / float64(ticks)
+		}
+		out = append(out, s)
+	}
+	return out
+}
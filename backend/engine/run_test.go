@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"math"
+	"testing"
+)
+
+// run builds config and runs it headless for ticks, keeping the series.
+func run(t *testing.T, config *ArchitectureConfig, ticks int) *RunResult {
+	t.Helper()
+	return RunFor(mustBuild(t, config), ticks, true)
+}
+
+// nodeSummary returns the summary of node id.
+func nodeSummary(t *testing.T, r *RunResult, id string) NodeSummary {
+	t.Helper()
+	for _, s := range r.Summary.Nodes {
+		if s.ID == id {
+			return s
+		}
+	}
+	t.Fatalf("no summary for %s", id)
+	return NodeSummary{}
+}
+
+// nodeAt returns the metrics of node id in tick i (counted from 1).
+func nodeAt(t *testing.T, r *RunResult, i int, id string) NodeMetrics {
+	t.Helper()
+	for _, m := range r.Ticks[i-1].Nodes {
+		if m.ID == id {
+			return m
+		}
+	}
+	t.Fatalf("no metrics for %s in tick %d", id, i)
+	return NodeMetrics{}
+}
+
+// eventsOf returns the events of the given type over a run, in order.
+func eventsOf(r *RunResult, kind string) []Event {
+	var events []Event
+	for _, tr := range r.Ticks {
+		for _, e := range tr.Events {
+			if e.Type == kind {
+				events = append(events, e)
+			}
+		}
+	}
+	return events
+}
+
+func near(got, want, tolerance float64) bool {
+	return math.Abs(got-want) <= tolerance
+}
+
+// chain is client c at rps -> appserver api -> database db, with capacity to
+// spare unless changed.
+func chain(rps float64) *ArchitectureConfig {
+	return &ArchitectureConfig{
+		Seed: 1,
+		Nodes: []NodeConfig{
+			{ID: "c", Type: "client", RPS: rps},
+			{ID: "api", Type: "appserver", MaxRPS: 1000, BaseLatency: 20, ConcurrencyLimit: 1000},
+			{ID: "db", Type: "database", MaxRPS: 1000, BaseLatency: 10, ConcurrencyLimit: 1000},
+		},
+		Edges: []EdgeConfig{{Source: "c", Target: "api"}, {Source: "api", Target: "db"}},
+	}
+}
+
+func TestRunForSummary(t *testing.T) {
+	r := run(t, chain(100), 20)
+	s := r.Summary
+	if s.Ticks != 20 || s.SimSeconds != 20 || len(r.Ticks) != 20 {
+		t.Fatalf("ran %d ticks over %vs with %d in the series, want 20", s.Ticks, s.SimSeconds, len(r.Ticks))
+	}
+	if s.AvgTotalRPS != 100 || len(s.Clients) != 1 || s.Clients[0].AvgInjectedRPS != 100 {
+		t.Errorf("injected %v (clients %+v), want 100", s.AvgTotalRPS, s.Clients)
+	}
+	if !near(s.Succeeded, 2000, 1e-6) || s.Failed != 0 || s.SuccessRate != 1 {
+		t.Errorf("succeeded %v failed %v rate %v, want all 2000", s.Succeeded, s.Failed, s.SuccessRate)
+	}
+	if mean := s.Clients[0].LatencyMean; !near(mean, 30, 1e-6) {
+		t.Errorf("client latency %v, want 30", mean)
+	}
+	if len(s.Bottlenecks) != 0 {
+		t.Errorf("bottlenecks %v, want none", s.Bottlenecks)
+	}
+}
+
+func TestRunForWithoutSeries(t *testing.T) {
+	r := RunFor(mustBuild(t, chain(100)), 5, false)
+	if r.Ticks != nil || r.Summary.Ticks != 5 {
+		t.Errorf("got %d ticks in the series and %d summarized, want none and 5", len(r.Ticks), r.Summary.Ticks)
+	}
+}
+
+// Run-wide percentiles come from every request in the run, not from
+// averaging per-tick figures.
+func TestRunForMixesLatencyOverTheRun(t *testing.T) {
+	config := chain(100)
+	config.Chaos = &ChaosPlan{Events: []ChaosEvent{{At: 11, Action: "latency", Node: "db", LatencyMs: 100}}}
+	r := run(t, config, 20)
+	c := r.Summary.Clients[0]
+	if !near(c.LatencyMean, 80, 1e-6) {
+		t.Errorf("mean %v, want 80 (half the run at 30ms, half at 130ms)", c.LatencyMean)
+	}
+	if !near(c.LatencyP99, 130, 1e-6) || !near(c.LatencyMax, 130, 1e-6) {
+		t.Errorf("p99 %v max %v, want 130", c.LatencyP99, c.LatencyMax)
+	}
+}
+
+func TestRunForCountsBottleneckTicks(t *testing.T) {
+	config := chain(150)
+	setNode(config, "db", func(nc *NodeConfig) { nc.MaxRPS = 100 })
+	r := run(t, config, 20)
+	db := nodeSummary(t, r, "db")
+	if db.BottleneckTicks != 20 || len(r.Summary.Bottlenecks) == 0 || r.Summary.Bottlenecks[0] != "db" {
+		t.Errorf("db a bottleneck for %d ticks (bottlenecks %v), want all 20 and first", db.BottleneckTicks, r.Summary.Bottlenecks)
+	}
+	if api := nodeSummary(t, r, "api"); api.BottleneckTicks != 0 {
+		t.Errorf("api a bottleneck for %d ticks, want 0", api.BottleneckTicks)
+	}
+	if r.Summary.SuccessRate >= 1 {
+		t.Error("a database whose queue overflowed failed nothing")
+	}
+}
+
+// Clients are summarized separately and add up to the run totals.
+func TestRunForSummarizesEachClient(t *testing.T) {
+	config := chain(100)
+	config.Nodes = append(config.Nodes, NodeConfig{ID: "mobile", Type: "client", RPS: 50})
+	config.Edges = append(config.Edges, EdgeConfig{Source: "mobile", Target: "api"})
+	r := run(t, config, 10)
+	s := r.Summary
+	if len(s.Clients) != 2 || s.AvgTotalRPS != 150 {
+		t.Fatalf("clients %+v, total %v, want 2 clients at 150 rps", s.Clients, s.AvgTotalRPS)
+	}
+	var succeeded float64
+	for _, c := range s.Clients {
+		succeeded += c.Succeeded
+	}
+	if !near(succeeded, s.Succeeded, 1e-6) || !near(s.Succeeded, 1500, 1e-6) {
+		t.Errorf("clients succeeded %v, run %v, want 1500", succeeded, s.Succeeded)
+	}
+}
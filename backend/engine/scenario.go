@@ -0,0 +1,191 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Scenario is a reusable traffic timeline. Each phase shapes the request rate
+// of one client (or every client) for a stretch of simulated time; outside
+// any phase a client sends its configured RPS. Times are simulated seconds
+// since the scenario started, so a scenario plays out the same whatever the
+// tick length.
+type Scenario struct {
+	Name   string         `json:"name,omitempty"`
+	Phases []TrafficPhase `json:"phases"`
+}
+
+// TrafficPhase shapes a client's traffic from Start for Duration seconds
+// (0 = until a later phase starts). Shapes:
+//   - "step":   jump to RPS.
+//   - "ramp":   go linearly from From to To over Duration.
+//   - "sine":   diurnal load, Base ± Amplitude with the given Period.
+//   - "spike":  flash crowd, jump to Peak and decay back to Base with time
+//     constant Decay.
+//   - "replay": real traffic from CSV, one "seconds,rps" or "rps" row per
+//     line (rows without a time are SampleSeconds apart).
+type TrafficPhase struct {
+	Client   string  `json:"client,omitempty"` // client node ID ("" = every client)
+	Start    float64 `json:"start"`
+	Duration float64 `json:"duration,omitempty"`
+	Shape    string  `json:"shape"`
+
+	RPS           float64 `json:"rps,omitempty"`
+	From          float64 `json:"from,omitempty"`
+	To            float64 `json:"to,omitempty"`
+	Base          float64 `json:"base,omitempty"`
+	Amplitude     float64 `json:"amplitude,omitempty"`
+	Period        float64 `json:"period,omitempty"`
+	Peak          float64 `json:"peak,omitempty"`
+	Decay         float64 `json:"decay,omitempty"`
+	CSV           string  `json:"csv,omitempty"`
+	SampleSeconds float64 `json:"sampleSeconds,omitempty"`
+
+	replay []replaySample
+}
+
+// replaySample is one row of a replayed traffic trace.
+type replaySample struct {
+	at  float64 // seconds since the phase started
+	rps float64
+}
+
+// Compile checks every phase and parses replay data. It must be called
+// before the scenario is used.
+func (sc *Scenario) Compile() error {
+	for i := range sc.Phases {
+		p := &sc.Phases[i]
+		if p.Start < 0 || p.Duration < 0 {
+			return fmt.Errorf("phase %d: start and duration must not be negative", i)
+		}
+		switch p.Shape {
+		case "step":
+		case "ramp":
+			if p.Duration <= 0 {
+				return fmt.Errorf("phase %d: ramp needs a duration", i)
+			}
+		case "sine":
+			if p.Period <= 0 {
+				return fmt.Errorf("phase %d: sine needs a period", i)
+			}
+		case "spike":
+			if p.Decay <= 0 {
+				return fmt.Errorf("phase %d: spike needs a decay", i)
+			}
+		case "replay":
+			samples, err := parseReplay(p.CSV, p.SampleSeconds)
+			if err != nil {
+				return fmt.Errorf("phase %d: %w", i, err)
+			}
+			p.replay = samples
+		default:
+			return fmt.Errorf("phase %d: unknown shape %q", i, p.Shape)
+		}
+	}
+	return nil
+}
+
+// parseReplay reads a CSV trace. A first line that isn't numeric is treated
+// as a header.
+func parseReplay(csv string, sampleSeconds float64) ([]replaySample, error) {
+	if sampleSeconds <= 0 {
+		sampleSeconds = 1
+	}
+	var samples []replaySample
+	for n, line := range strings.Split(strings.TrimSpace(csv), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		values := make([]float64, len(fields))
+		var err error
+		for i, f := range fields {
+			if values[i], err = strconv.ParseFloat(strings.TrimSpace(f), 64); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			if n == 0 {
+				continue // header
+			}
+			return nil, fmt.Errorf("replay line %d: %q is not numeric", n+1, line)
+		}
+		s := replaySample{at: float64(len(samples)) * sampleSeconds, rps: values[len(values)-1]}
+		if len(values) >= 2 {
+			s.at = values[0]
+		}
+		if len(samples) > 0 && s.at < samples[len(samples)-1].at {
+			return nil, fmt.Errorf("replay line %d: time goes backwards", n+1)
+		}
+		samples = append(samples, s)
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("replay has no samples")
+	}
+	return samples, nil
+}
+
+// appliesTo reports whether the phase shapes traffic of the given client at
+// time t.
+func (p *TrafficPhase) appliesTo(client string, t float64) bool {
+	if p.Client != "" && p.Client != client {
+		return false
+	}
+	return t >= p.Start && (p.Duration <= 0 || t < p.Start+p.Duration)
+}
+
+// rate returns the phase's request rate at time t.
+func (p *TrafficPhase) rate(t float64) float64 {
+	elapsed := t - p.Start
+	var rps float64
+	switch p.Shape {
+	case "step":
+		rps = p.RPS
+	case "ramp":
+		progress := math.Min(1, elapsed/p.Duration)
+		rps = p.From + (p.To-p.From)*progress
+	case "sine":
+		rps = p.Base + p.Amplitude*math.Sin(2*math.Pi*elapsed/p.Period)
+	case "spike":
+		rps = p.Base + (p.Peak-p.Base)*math.Exp(-elapsed/p.Decay)
+	case "replay":
+		// Hold each sample until the next one; hold the last one after the end.
+		rps = p.replay[0].rps
+		for _, s := range p.replay {
+			if s.at > elapsed {
+				break
+			}
+			rps = s.rps
+		}
+	}
+	return math.Max(0, rps)
+}
+
+// phaseAt returns the index of the phase shaping the client's traffic at time
+// t, or -1 if none does. When phases overlap, the one that started last wins.
+func (sc *Scenario) phaseAt(client string, t float64) int {
+	active := -1
+	for i := range sc.Phases {
+		p := &sc.Phases[i]
+		if p.appliesTo(client, t) && (active < 0 || p.Start >= sc.Phases[active].Start) {
+			active = i
+		}
+	}
+	return active
+}
+
+// checkClients verifies that every phase names a client node of the graph.
+func (sc *Scenario) checkClients(nodes map[string]Node) error {
+	for i, p := range sc.Phases {
+		if p.Client == "" {
+			continue
+		}
+		if n, ok := nodes[p.Client]; !ok || n.Type() != "client" {
+			return fmt.Errorf("phase %d: %q is not a client node", i, p.Client)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// injected returns what client id sent in each of the first ticks of a run.
+func injected(t *testing.T, r *RunResult, id string, ticks int) []float64 {
+	t.Helper()
+	var got []float64
+	for _, tr := range r.Ticks[:ticks] {
+		for _, c := range tr.Clients {
+			if c.ID == id {
+				got = append(got, c.InjectedRPS)
+			}
+		}
+	}
+	if len(got) != ticks {
+		t.Fatalf("no traffic from %s", id)
+	}
+	return got
+}
+
+// Each tick sends the rate of its phase at the time the tick starts, so tick
+// i is at t = i-1 seconds.
+func TestScenarioShapes(t *testing.T) {
+	tests := []struct {
+		name  string
+		phase TrafficPhase
+		want  []float64
+	}{
+		{"step", TrafficPhase{Start: 2, Duration: 3, Shape: "step", RPS: 300}, []float64{100, 100, 300, 300, 300, 100}},
+		{"ramp", TrafficPhase{Duration: 4, Shape: "ramp", From: 0, To: 200}, []float64{0, 50, 100, 150, 100, 100}},
+		{"sine", TrafficPhase{Shape: "sine", Base: 100, Amplitude: 50, Period: 4}, []float64{100, 150, 100, 50, 100, 150}},
+		{"spike", TrafficPhase{Shape: "spike", Base: 100, Peak: 500, Decay: 2}, []float64{
+			500, 100 + 400*math.Exp(-0.5), 100 + 400*math.Exp(-1), 100 + 400*math.Exp(-1.5), 100 + 400*math.Exp(-2), 100 + 400*math.Exp(-2.5),
+		}},
+		{"replay", TrafficPhase{Start: 1, Shape: "replay", CSV: "seconds,rps\n0,50\n2,80\n3,20"}, []float64{100, 50, 50, 80, 20, 20}},
+		{"replay without times", TrafficPhase{Shape: "replay", CSV: "10\n20\n30", SampleSeconds: 2}, []float64{10, 10, 20, 20, 30, 30}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := chain(100)
+			config.Scenario = &Scenario{Phases: []TrafficPhase{tt.phase}}
+			if got := injected(t, run(t, config, len(tt.want)), "c", len(tt.want)); !equalRates(got, tt.want) {
+				t.Errorf("sent %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Phases can target one client; where phases overlap the later one wins.
+func TestScenarioPhases(t *testing.T) {
+	config := chain(100)
+	config.Nodes = append(config.Nodes, NodeConfig{ID: "mobile", Type: "client", RPS: 50})
+	config.Edges = append(config.Edges, EdgeConfig{Source: "mobile", Target: "api"})
+	config.Scenario = &Scenario{Phases: []TrafficPhase{
+		{Client: "mobile", Start: 1, Duration: 4, Shape: "step", RPS: 200},
+		{Client: "mobile", Start: 2, Duration: 1, Shape: "step", RPS: 400},
+	}}
+	r := run(t, config, 6)
+	if got, want := injected(t, r, "mobile", 6), []float64{50, 200, 400, 200, 200, 50}; !equalRates(got, want) {
+		t.Errorf("mobile sent %v, want %v", got, want)
+	}
+	if got, want := injected(t, r, "c", 6), []float64{100, 100, 100, 100, 100, 100}; !equalRates(got, want) {
+		t.Errorf("c sent %v, want %v", got, want)
+	}
+	var ticks []int
+	for _, e := range eventsOf(r, "scenario-phase") {
+		if e.NodeID != "mobile" {
+			t.Errorf("phase event for %s", e.NodeID)
+		}
+		ticks = append(ticks, e.Tick)
+	}
+	if want := []int{2, 3, 4, 6}; !reflect.DeepEqual(ticks, want) {
+		t.Errorf("phase changes at ticks %v, want %v", ticks, want)
+	}
+}
+
+func TestScenarioIsChecked(t *testing.T) {
+	tests := []struct {
+		name  string
+		phase TrafficPhase
+		err   string
+	}{
+		{"ramp without duration", TrafficPhase{Shape: "ramp", To: 100}, "ramp needs a duration"},
+		{"unknown shape", TrafficPhase{Shape: "square"}, "unknown shape"},
+		{"bad replay", TrafficPhase{Shape: "replay", CSV: "0,10\nsoon,20"}, "not numeric"},
+		{"replay backwards", TrafficPhase{Shape: "replay", CSV: "5,10\n2,20"}, "time goes backwards"},
+		{"not a client", TrafficPhase{Client: "api", Shape: "step"}, `"api" is not a client`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := chain(100)
+			config.Scenario = &Scenario{Phases: []TrafficPhase{tt.phase}}
+			if _, err := BuildGraphFromConfig(config); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func equalRates(got, want []float64) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if !near(got[i], want[i], 1e-6) {
+			return false
+		}
+	}
+	return true
+}
@@ -10,23 +10,68 @@ import (
 
 // TickResult is the per-tick output sent to the frontend via WebSocket.
 type TickResult struct {
-	Tick        int           `json:"tick"`
-	Timestamp   int64         `json:"timestamp"`
-	Nodes       []NodeMetrics `json:"nodes"`
-	Bottlenecks []string      `json:"bottleneckIds"`
-	TotalRPS    float64       `json:"totalRPS"`
+	Tick        int             `json:"tick"`
+	Timestamp   int64           `json:"timestamp"`
+	SimTime     float64         `json:"simTime"`     // simulated seconds elapsed at the end of this tick
+	TickSeconds float64         `json:"tickSeconds"` // simulated seconds this tick covered
+	Nodes       []NodeMetrics   `json:"nodes"`
+	Bottlenecks []string        `json:"bottleneckIds"`
+	TotalRPS    float64         `json:"totalRPS"`    // new requests per second across all clients
+	SuccessRate float64         `json:"successRate"` // end-to-end availability across all clients
+	Clients     []ClientMetrics `json:"clients"`
+	Classes     []ClassMetrics  `json:"classes,omitempty"` // request classes, across clients
+	Events      []Event         `json:"events,omitempty"`
+}
+
+// Event is a notable state change during a tick (e.g. a breaker tripping).
+type Event struct {
+	Tick    int    `json:"tick"`
+	NodeID  string `json:"nodeId"`
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// ClientMetrics is the end-to-end view of the traffic entering at one client.
+type ClientMetrics struct {
+	ID          string  `json:"id"`
+	Label       string  `json:"label"`
+	InjectedRPS float64 `json:"injectedRPS"`       // new requests per second
+	Retries     float64 `json:"retries,omitempty"` // retries sent this tick
+	Succeeded   float64 `json:"succeeded"`
+	Failed      float64 `json:"failed"`
+	SuccessRate float64 `json:"successRate"`
+	LatencySummary
 }
 
 // Simulator runs the tick-based simulation loop.
 type Simulator struct {
-	graph      *Graph
-	mu         sync.RWMutex
-	tickCount  int
-	spikeOn    bool
-	trafficRPS float64
-	output     chan TickResult
-	cancel     context.CancelFunc
-	done       chan struct{}
+	graph     *Graph
+	mu        sync.RWMutex
+	tickMu    sync.Mutex // serializes ticks from the loop and from Step
+	stopped   bool       // output is closed; guarded by tickMu
+	tickCount int
+	spikeOn   bool
+	paused    bool
+	quiet     bool // no progress logging (headless runs)
+	output    chan TickResult
+	cancel    context.CancelFunc
+	done      chan struct{}
+
+	// simulated clock
+	tickSeconds  float64
+	speed        float64
+	simTime      float64
+	clockChanged chan struct{}
+
+	// traffic scenario
+	scenario      *Scenario
+	scenarioStart float64        // simulated time the scenario was attached
+	scenarioPhase map[string]int // active phase per client, for change events
+
+	chaos *chaosRun // fault schedule in progress
+
+	pendingEvents []Event                // changes made between ticks, reported with the next one
+	classTotals   map[string]*classTotal // last tick, by request class
 
 	// for bottleneck detection
 	prevQueueDepth map[string]float64
@@ -34,25 +79,169 @@ type Simulator struct {
 
 // NewSimulator creates a new simulator from a graph.
 func NewSimulator(graph *Graph) *Simulator {
-	return &Simulator{
+	tickSeconds := graph.TickSeconds
+	if tickSeconds <= 0 {
+		tickSeconds = 1
+	}
+	speed := graph.Speed
+	if speed <= 0 {
+		speed = DefaultSpeed
+	}
+	s := &Simulator{
 		graph:          graph,
-		trafficRPS:     graph.TrafficRPS,
 		output:         make(chan TickResult, 100),
 		done:           make(chan struct{}),
+		tickSeconds:    tickSeconds,
+		speed:          clampSpeed(speed),
+		clockChanged:   make(chan struct{}, 1),
+		scenario:       graph.Scenario,
+		scenarioPhase:  make(map[string]int),
 		prevQueueDepth: make(map[string]float64),
 	}
+	if graph.Chaos != nil {
+		s.chaos = newChaosRun(graph.Chaos, 0, graph.Seed)
+	}
+	return s
 }
 
-// Output returns the channel to read tick results from.
-func (s *Simulator) Output() <-chan TickResult {
-	return s.output
+// SetScenario attaches a traffic scenario, starting its timeline at the
+// current simulated time. A nil scenario detaches it and clients go back to
+// their configured RPS.
+func (s *Simulator) SetScenario(sc *Scenario) error {
+	if sc != nil {
+		if err := sc.Compile(); err != nil {
+			return err
+		}
+	}
+	s.tickMu.Lock()
+	defer s.tickMu.Unlock()
+	if sc != nil {
+		if err := sc.checkClients(s.graph.Nodes); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenario = sc
+	s.scenarioStart = s.simTime
+	s.scenarioPhase = make(map[string]int)
+	return nil
+}
+
+// applyScenario sets each client's rate for a tick starting at simulated
+// time now, and reports clients moving between phases.
+func (s *Simulator) applyScenario(sc *Scenario, now float64) {
+	for _, node := range s.graph.Sorted {
+		client, ok := node.(*Client)
+		if !ok {
+			continue
+		}
+		idx := -1
+		if sc != nil {
+			idx = sc.phaseAt(client.ID(), now)
+		}
+		client.scripted = idx >= 0
+		if idx >= 0 {
+			client.scriptedRPS = sc.Phases[idx].rate(now)
+		}
+
+		prev, seen := s.scenarioPhase[client.ID()]
+		if !seen {
+			prev = -1
+		}
+		if idx == prev {
+			continue
+		}
+		s.scenarioPhase[client.ID()] = idx
+		if idx >= 0 {
+			p := sc.Phases[idx]
+			client.emit("scenario-phase", fmt.Sprintf("%s phase from t=%.0fs", p.Shape, p.Start))
+		} else {
+			client.emit("scenario-phase", "back to configured RPS")
+		}
+	}
+}
+
+// SetChaos attaches a fault schedule; the next tick is its tick 1. A nil
+// plan detaches it. Faults already applied stay in place.
+func (s *Simulator) SetChaos(plan *ChaosPlan) error {
+	s.tickMu.Lock()
+	defer s.tickMu.Unlock()
+	if plan == nil {
+		s.chaos = nil
+		return nil
+	}
+	if err := plan.check(s.graph.Nodes); err != nil {
+		return err
+	}
+	s.chaos = newChaosRun(plan, s.tickCount, s.graph.Seed)
+	return nil
 }
 
-// SetTrafficRPS updates the traffic injection rate.
-func (s *Simulator) SetTrafficRPS(rps float64) {
+// Simulation speed limits and default, in simulated seconds per wall-clock
+// second.
+const (
+	MinSpeed     = 0.1
+	MaxSpeed     = 100.0
+	DefaultSpeed = 2.0
+)
+
+// clampSpeed keeps a speed factor within [MinSpeed, MaxSpeed].
+func clampSpeed(speed float64) float64 {
+	return math.Max(MinSpeed, math.Min(MaxSpeed, speed))
+}
+
+// SetSpeed changes how many simulated seconds pass per wall-clock second.
+// It is clamped to [MinSpeed, MaxSpeed] and takes effect immediately.
+func (s *Simulator) SetSpeed(speed float64) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.trafficRPS = rps
+	s.speed = clampSpeed(speed)
+	s.mu.Unlock()
+	s.notifyClock()
+}
+
+// SetTickSeconds changes how much simulated time each tick covers. Rates are
+// unaffected; backlogs grow or drain by rate * seconds per tick.
+func (s *Simulator) SetTickSeconds(seconds float64) {
+	if seconds <= 0 {
+		return
+	}
+	s.mu.Lock()
+	s.tickSeconds = seconds
+	s.mu.Unlock()
+	s.notifyClock()
+}
+
+// Clock returns the simulated seconds per tick, the speed factor and the
+// simulated time elapsed so far.
+func (s *Simulator) Clock() (tickSeconds, speed, simTime float64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tickSeconds, s.speed, s.simTime
+}
+
+// notifyClock wakes the simulation loop so a new tick interval applies now.
+func (s *Simulator) notifyClock() {
+	select {
+	case s.clockChanged <- struct{}{}:
+	default:
+	}
+}
+
+// interval returns the wall-clock time between ticks.
+func (s *Simulator) interval() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d := time.Duration(s.tickSeconds / s.speed * float64(time.Second))
+	if d < time.Millisecond {
+		d = time.Millisecond
+	}
+	return d
+}
+
+// Output returns the channel to read tick results from.
+func (s *Simulator) Output() <-chan TickResult {
+	return s.output
 }
 
 // SetSpike toggles spike traffic mode (2x multiplier).
@@ -73,6 +262,24 @@ func (s *Simulator) SetNodeDown(nodeID string, down bool) bool {
 	return true
 }
 
+// SetNodeDegraded puts a node into a partial failure, or restores it with a
+// nil degradation.
+func (s *Simulator) SetNodeDegraded(nodeID string, d *Degradation) (bool, error) {
+	s.tickMu.Lock()
+	defer s.tickMu.Unlock()
+	node, ok := s.graph.Nodes[nodeID]
+	if !ok {
+		return false, nil
+	}
+	if d != nil {
+		if err := d.check(); err != nil {
+			return true, err
+		}
+	}
+	baseOf(node).Degraded = d
+	return true, nil
+}
+
 // UpdateNodeConfig updates a node's configuration live during simulation.
 // Supports maxRPS, baseLatency, and other node-specific settings.
 func (s *Simulator) UpdateNodeConfig(nodeID string, maxRPS, baseLatency, readRatio, concurrency, rps float64, isReplica bool, algorithm string) bool {
@@ -90,7 +297,10 @@ func (s *Simulator) UpdateNodeConfig(nodeID string, maxRPS, baseLatency, readRat
 			n.ReadRatio = readRatio
 		}
 	case *AppServer:
-		if maxRPS > 0 {
+		if maxRPS > 0 && n.scaling.enabled() {
+			n.scaling.InstanceRPS = maxRPS
+			n.CapacityRPS = n.scaling.capacity()
+		} else if maxRPS > 0 {
 			n.CapacityRPS = maxRPS
 		}
 		if baseLatency > 0 {
@@ -121,6 +331,27 @@ func (s *Simulator) UpdateNodeConfig(nodeID string, maxRPS, baseLatency, readRat
 		if readRatio > 0 {
 			n.ReadRatio = readRatio
 		}
+	case *Cache:
+		if maxRPS > 0 {
+			n.CapacityRPS = maxRPS
+		}
+		if baseLatency > 0 {
+			n.BaseLatency = baseLatency
+		}
+	case *Queue:
+		if maxRPS > 0 {
+			n.IngestRPS = maxRPS
+		}
+		if baseLatency > 0 {
+			n.BaseLatency = baseLatency
+		}
+	case *Gateway:
+		if maxRPS > 0 {
+			n.RateLimit = maxRPS
+		}
+		if baseLatency > 0 {
+			n.BaseLatency = baseLatency
+		}
 	default:
 		return false
 	}
@@ -136,12 +367,22 @@ func (s *Simulator) ResetQueues() {
 	}
 }
 
-// UpdateGraph replaces the current simulation graph with a new one.
-// This allows adding/removing nodes and edges while the simulation is running.
+// UpdateGraph switches the simulation to a new graph while it is running,
+// e.g. to add or remove nodes and edges. Nodes that survive the edit keep
+// their state (see reconcile); the changes are reported with the next tick.
 func (s *Simulator) UpdateGraph(newGraph *Graph) {
+	s.tickMu.Lock()
+	defer s.tickMu.Unlock()
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.graph = newGraph
+	graph, events := reconcile(s.graph, newGraph, newGraph.OnRemove)
+	for id := range s.prevQueueDepth {
+		if _, ok := graph.Nodes[id]; !ok {
+			delete(s.prevQueueDepth, id)
+		}
+	}
+	s.graph = graph
+	s.pendingEvents = append(s.pendingEvents, events...)
 }
 
 // Start begins the simulation loop.
@@ -152,73 +393,194 @@ func (s *Simulator) Start() {
 	go s.run(ctx)
 }
 
-// Stop halts the simulation loop.
+// Stop halts the simulation loop and closes the output. Ticks requested
+// after that (a Step racing the stop) do nothing.
 func (s *Simulator) Stop() {
 	if s.cancel != nil {
 		s.cancel()
 	}
 	<-s.done
+	s.tickMu.Lock()
+	defer s.tickMu.Unlock()
+	if s.stopped {
+		return
+	}
+	s.stopped = true
 	close(s.output)
 }
 
+// Pause freezes the simulation loop. The session stays open and can still be
+// advanced with Step.
+func (s *Simulator) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = true
+}
+
+// Resume restarts a paused simulation loop.
+func (s *Simulator) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = false
+}
+
+// Paused reports whether the simulation loop is paused.
+func (s *Simulator) Paused() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.paused
+}
+
+// Step advances the simulation by n ticks right away and returns their
+// results. The results are also streamed like regular ticks. A stopped
+// simulation doesn't advance.
+func (s *Simulator) Step(n int) []TickResult {
+	results := make([]TickResult, 0, n)
+	for i := 0; i < n; i++ {
+		result, ok := s.tick()
+		if !ok {
+			break
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
 // run is the main simulation loop.
 func (s *Simulator) run(ctx context.Context) {
 	defer close(s.done)
 
-	ticker := time.NewTicker(500 * time.Millisecond)
+	ticker := time.NewTicker(s.interval())
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-s.clockChanged:
+			ticker.Reset(s.interval())
 		case <-ticker.C:
-			s.tick()
+			if !s.Paused() {
+				s.tick()
+			}
 		}
 	}
 }
 
-// tick executes a single simulation step.
-func (s *Simulator) tick() {
-	s.mu.RLock()
-	trafficRPS := s.trafficRPS
+// tick executes a single simulation step and returns its result, or false
+// once the simulator is stopped.
+func (s *Simulator) tick() (TickResult, bool) {
+	s.tickMu.Lock()
+	defer s.tickMu.Unlock()
+	if s.stopped {
+		return TickResult{}, false
+	}
+
+	s.mu.Lock()
 	spike := s.spikeOn
-	s.mu.RUnlock()
+	dt := s.tickSeconds
+	scenarioTime := s.simTime - s.scenarioStart
+	scenario := s.scenario
+	s.simTime += dt
+	simTime := s.simTime
+	s.mu.Unlock()
 
-	if spike {
-		trafficRPS *= 2.0
+	s.tickCount++
+
+	// Every node works in simulated time: rates per second, backlogs that
+	// change by rate * dt over the tick.
+	for _, node := range s.graph.Sorted {
+		baseOf(node).dt = dt
 	}
 
-	s.tickCount++
+	s.applyScenario(scenario, scenarioTime)
+	if s.chaos != nil {
+		s.chaos.apply(s.graph, s.tickCount)
+	}
+
+	// Requests sent over back edges last tick arrive now
+	for _, node := range s.graph.Sorted {
+		baseOf(node).flushDeferred()
+	}
 
 	// 1. Inject traffic at all client nodes
 	clientCount := 0
-	for _, node := range s.graph.Nodes {
-		if node.Type() == "client" {
-			if client, ok := node.(*Client); ok {
-				client.AddIncoming(client.RPS)
-				clientCount++
-			}
+	totalRPS := 0.0
+	for _, node := range s.graph.Entries {
+		client, ok := node.(*Client)
+		if !ok {
+			continue
 		}
+		client.injected = client.Arrivals()
+		if spike {
+			client.injected *= 2.0
+		}
+		client.AddIncoming(client.injected)
+		totalRPS += client.injected
+		clientCount++
 	}
-	if s.tickCount%10 == 0 {
-		fmt.Printf("Tick %d: Injected into %d clients (s.trafficRPS=%.1f)\n", s.tickCount, clientCount, trafficRPS)
+	if !s.quiet && s.tickCount%10 == 0 {
+		fmt.Printf("Tick %d: Injected %.1f rps into %d clients\n", s.tickCount, totalRPS, clientCount)
 	}
 
-	// 2. Process in topological order (each node captures & resets its own incoming)
+	// 2. Process in order (each node captures & resets its own incoming),
+	// then send classes with routes of their own where they go
 	for _, node := range s.graph.Sorted {
 		node.Process()
+		baseOf(node).flushDetours()
+	}
+
+	// 3. Settle in reverse order so every node sees its downstream's latency
+	for i := len(s.graph.Sorted) - 1; i >= 0; i-- {
+		node := s.graph.Sorted[i]
+		node.Settle()
+		if c, ok := node.(interface{ settleClasses() }); ok {
+			c.settleClasses()
+		}
+	}
+	s.classTotals = s.graph.classTotals()
+
+	events := s.pendingEvents
+	s.pendingEvents = nil
+	for i := range events {
+		events[i].Tick = s.tickCount
+	}
+	for _, node := range s.graph.Sorted {
+		for _, e := range baseOf(node).drainEvents() {
+			e.Tick = s.tickCount
+			events = append(events, e)
+		}
 	}
 
 	// 4. Collect metrics and detect bottlenecks (all nodes above threshold)
 	metrics := make([]NodeMetrics, 0, len(s.graph.Sorted))
 	var bottleneckIDs []string
+	var clients []ClientMetrics
+	var succeeded, failed float64
 	const bottleneckThreshold = 0.7
 
 	for _, node := range s.graph.Sorted {
 		m := node.GetMetrics()
+		if f, ok := node.(interface{ fillMetrics(*NodeMetrics) }); ok {
+			f.fillMetrics(&m)
+		}
 		metrics = append(metrics, m)
 
+		if c, ok := node.(*Client); ok {
+			clients = append(clients, ClientMetrics{
+				ID:             m.ID,
+				Label:          m.Label,
+				InjectedRPS:    c.injected,
+				Retries:        m.Retries,
+				Succeeded:      m.Succeeded,
+				Failed:         m.Failed,
+				SuccessRate:    m.SuccessRate,
+				LatencySummary: m.LatencySummary,
+			})
+			succeeded += m.Succeeded
+			failed += m.Failed
+		}
+
 		// Bottleneck scoring: utilization + 0.3 * queue growth rate
 		queueGrowth := 0.0
 		if prev, ok := s.prevQueueDepth[m.ID]; ok {
@@ -233,12 +595,25 @@ func (s *Simulator) tick() {
 		s.prevQueueDepth[m.ID] = m.QueueDepth
 	}
 
+	// Removed nodes that finished draining leave the graph.
+	for _, e := range s.graph.finishDrains() {
+		e.Tick = s.tickCount
+		events = append(events, e)
+		delete(s.prevQueueDepth, e.NodeID)
+	}
+
 	result := TickResult{
 		Tick:        s.tickCount,
 		Timestamp:   time.Now().UnixMilli(),
+		SimTime:     simTime,
+		TickSeconds: dt,
 		Nodes:       metrics,
 		Bottlenecks: bottleneckIDs,
-		TotalRPS:    trafficRPS,
+		TotalRPS:    totalRPS,
+		SuccessRate: successRate(succeeded, failed),
+		Clients:     clients,
+		Classes:     s.graph.classMetrics(s.classTotals),
+		Events:      events,
 	}
 
 	// Non-blocking send
@@ -247,4 +622,5 @@ func (s *Simulator) tick() {
 	default:
 		// Channel full, skip this tick (consumer is slow)
 	}
+	return result, true
 }
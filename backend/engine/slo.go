@@ -0,0 +1,163 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SLO is an assertion on the summary of a run, written as
+// "[node.]metric op value", e.g. "p99 <= 250" or "api.successRate >= 0.999".
+// Without a node the metric is taken across all clients: the end-to-end
+// success rate, or the worst client's latency. A request class can stand in
+// for the node, e.g. "checkout.p99 <= 300".
+type SLO struct {
+	Expr      string
+	Node      string
+	Metric    string
+	Op        string
+	Threshold float64
+}
+
+// SLOResult is the outcome of checking one SLO.
+type SLOResult struct {
+	Expr   string  `json:"expr"`
+	Actual float64 `json:"actual"`
+	Passed bool    `json:"passed"`
+}
+
+// sloOps is ordered so two-character operators match before their prefixes.
+var sloOps = []string{"<=", ">=", "<", ">"}
+
+// ParseSLO parses an SLO expression.
+func ParseSLO(expr string) (SLO, error) {
+	for _, op := range sloOps {
+		i := strings.Index(expr, op)
+		if i < 0 {
+			continue
+		}
+		lhs := strings.TrimSpace(expr[:i])
+		rhs := strings.TrimSpace(expr[i+len(op):])
+		threshold, err := strconv.ParseFloat(rhs, 64)
+		if err != nil {
+			return SLO{}, fmt.Errorf("slo %q: invalid threshold %q", expr, rhs)
+		}
+		slo := SLO{Expr: expr, Metric: lhs, Op: op, Threshold: threshold}
+		if dot := strings.LastIndex(lhs, "."); dot >= 0 {
+			slo.Node, slo.Metric = lhs[:dot], lhs[dot+1:]
+		}
+		if slo.Metric == "" {
+			return SLO{}, fmt.Errorf("slo %q: missing metric", expr)
+		}
+		return slo, nil
+	}
+	return SLO{}, fmt.Errorf("slo %q: expected one of <, <=, >, >=", expr)
+}
+
+// Check evaluates the SLO against a run summary.
+func (s SLO) Check(summary RunSummary) (SLOResult, error) {
+	actual, err := s.value(summary)
+	if err != nil {
+		return SLOResult{}, err
+	}
+	passed := false
+	switch s.Op {
+	case "<":
+		passed = actual < s.Threshold
+	case "<=":
+		passed = actual <= s.Threshold
+	case ">":
+		passed = actual > s.Threshold
+	case ">=":
+		passed = actual >= s.Threshold
+	}
+	return SLOResult{Expr: s.Expr, Actual: actual, Passed: passed}, nil
+}
+
+// value looks up the metric the SLO refers to.
+func (s SLO) value(summary RunSummary) (float64, error) {
+	if s.Node == "" {
+		if s.Metric == "successRate" {
+			return summary.SuccessRate, nil
+		}
+		// Latency across clients: the worst client decides.
+		worst, found := 0.0, false
+		for _, c := range summary.Clients {
+			v, ok := latencyMetric(c.LatencySummary, s.Metric)
+			if !ok {
+				return 0, fmt.Errorf("slo %q: unknown metric %q", s.Expr, s.Metric)
+			}
+			if !found || v > worst {
+				worst, found = v, true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("slo %q: no clients in the run", s.Expr)
+		}
+		return worst, nil
+	}
+
+	for _, n := range summary.Nodes {
+		if n.ID != s.Node {
+			continue
+		}
+		if v, ok := latencyMetric(n.LatencySummary, s.Metric); ok {
+			return v, nil
+		}
+		switch s.Metric {
+		case "successRate":
+			return n.SuccessRate, nil
+		case "failed":
+			return n.Failed, nil
+		case "dropped":
+			return n.Dropped, nil
+		case "avgUtilization":
+			return n.AvgUtilization, nil
+		case "peakUtilization":
+			return n.PeakUtilization, nil
+		case "avgThroughput":
+			return n.AvgThroughput, nil
+		case "peakQueueDepth":
+			return n.PeakQueueDepth, nil
+		}
+		return 0, fmt.Errorf("slo %q: unknown metric %q", s.Expr, s.Metric)
+	}
+
+	for _, c := range summary.Classes {
+		if c.Name != s.Node {
+			continue
+		}
+		if v, ok := latencyMetric(c.LatencySummary, s.Metric); ok {
+			return v, nil
+		}
+		switch s.Metric {
+		case "successRate":
+			return c.SuccessRate, nil
+		case "failed":
+			return c.Failed, nil
+		case "avgInjectedRPS":
+			return c.AvgInjectedRPS, nil
+		}
+		return 0, fmt.Errorf("slo %q: unknown metric %q", s.Expr, s.Metric)
+	}
+	return 0, fmt.Errorf("slo %q: unknown node or class %q", s.Expr, s.Node)
+}
+
+// latencyMetric returns a latency percentile by its SLO name.
+func latencyMetric(l LatencySummary, metric string) (float64, bool) {
+	switch metric {
+	case "p50":
+		return l.LatencyP50, true
+	case "p90":
+		return l.LatencyP90, true
+	case "p95":
+		return l.LatencyP95, true
+	case "p99":
+		return l.LatencyP99, true
+	case "max":
+		return l.LatencyMax, true
+	case "mean":
+		return l.LatencyMean, true
+	}
+	return 0, false
+}
@@ -0,0 +1,333 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Finding severities.
+const (
+	SeverityError   = "error"   // the architecture can't be simulated
+	SeverityWarning = "warning" // it runs, but probably not as intended
+)
+
+// Finding is one problem found in an architecture.
+type Finding struct {
+	Severity string    `json:"severity"`
+	Rule     string    `json:"rule"`
+	Message  string    `json:"message"`
+	Nodes    []string  `json:"nodes,omitempty"`
+	Edges    []EdgeRef `json:"edges,omitempty"`
+}
+
+// EdgeRef identifies an edge by its endpoints.
+type EdgeRef struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// Rule is a named check over an architecture. Check only fills in the
+// location and message of its findings; Validate sets Rule and Severity.
+type Rule struct {
+	Code     string
+	Severity string
+	Check    func(config *ArchitectureConfig) []Finding
+}
+
+// DefaultRules is the rule set used by the validate endpoint and CLI.
+var DefaultRules = []Rule{
+	{"duplicate-id", SeverityError, checkDuplicateIDs},
+	{"unknown-type", SeverityError, checkNodeTypes},
+	{"dangling-edge", SeverityError, checkEdges},
+	{"cycle", SeverityError, checkCycles},
+	{"database-downstream", SeverityWarning, checkDatabaseDownstream},
+	{"dead-end", SeverityWarning, checkDeadEnds},
+	{"no-sink", SeverityWarning, checkClientSinks},
+	{"no-primary", SeverityWarning, checkRouterPrimaries},
+	{"unreachable", SeverityWarning, checkReachable},
+}
+
+// Validate runs rules over config and returns their findings, errors first.
+// When no rule reports an error, the graph is built as well, so that
+// anything only the builder checks (scenarios, chaos plans, ...) is reported
+// under the rule "build".
+func Validate(config *ArchitectureConfig, rules []Rule) []Finding {
+	var findings []Finding
+	failed := false
+	for _, r := range rules {
+		for _, f := range r.Check(config) {
+			f.Rule, f.Severity = r.Code, r.Severity
+			failed = failed || f.Severity == SeverityError
+			findings = append(findings, f)
+		}
+	}
+	if !failed {
+		if _, err := BuildGraphFromConfig(config); err != nil {
+			findings = append(findings, Finding{Severity: SeverityError, Rule: "build", Message: err.Error()})
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Severity == SeverityError && findings[j].Severity != SeverityError
+	})
+	return findings
+}
+
+// topology is the shape of a config, for rules that walk it. Duplicate IDs
+// keep their first definition.
+type topology struct {
+	ids   []string // in config order
+	nodes map[string]NodeConfig
+	out   map[string][]string
+}
+
+func newTopology(config *ArchitectureConfig) *topology {
+	t := &topology{nodes: make(map[string]NodeConfig), out: make(map[string][]string)}
+	for _, nc := range config.Nodes {
+		if _, ok := t.nodes[nc.ID]; !ok {
+			t.ids = append(t.ids, nc.ID)
+			t.nodes[nc.ID] = nc
+		}
+	}
+	for _, e := range config.Edges {
+		_, src := t.nodes[e.Source]
+		_, tgt := t.nodes[e.Target]
+		if src && tgt {
+			t.out[e.Source] = append(t.out[e.Source], e.Target)
+		}
+	}
+	return t
+}
+
+// reachable returns the nodes reachable from the given ones, them included.
+func (t *topology) reachable(from ...string) map[string]bool {
+	seen := make(map[string]bool)
+	stack := append([]string(nil), from...)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		stack = append(stack, t.out[id]...)
+	}
+	return seen
+}
+
+// kind returns the type of node id.
+func (t *topology) kind(id string) string {
+	return t.nodes[id].Type
+}
+
+// ofKind returns the IDs of nodes of type kind, in config order.
+func (t *topology) ofKind(kind string) []string {
+	var ids []string
+	for _, id := range t.ids {
+		if t.kind(id) == kind {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func checkDuplicateIDs(config *ArchitectureConfig) []Finding {
+	var findings []Finding
+	count := make(map[string]int)
+	for _, nc := range config.Nodes {
+		count[nc.ID]++
+		if count[nc.ID] == 2 {
+			findings = append(findings, Finding{
+				Nodes:   []string{nc.ID},
+				Message: fmt.Sprintf("node ID %q is used more than once; only one of the nodes would be simulated", nc.ID),
+			})
+		}
+	}
+	return findings
+}
+
+// nodeTypes are the node types BuildGraphFromConfig knows.
+var nodeTypes = map[string]bool{
+	"client": true, "loadbalancer": true, "appserver": true, "database": true, "dbrouter": true,
+	"cache": true, "queue": true, "circuitbreaker": true, "gateway": true,
+}
+
+func checkNodeTypes(config *ArchitectureConfig) []Finding {
+	var findings []Finding
+	for _, nc := range config.Nodes {
+		if !nodeTypes[nc.Type] {
+			findings = append(findings, Finding{
+				Nodes:   []string{nc.ID},
+				Message: fmt.Sprintf("unknown node type %q", nc.Type),
+			})
+		}
+	}
+	return findings
+}
+
+func checkEdges(config *ArchitectureConfig) []Finding {
+	t := newTopology(config)
+	var findings []Finding
+	for _, e := range config.Edges {
+		for _, id := range []string{e.Source, e.Target} {
+			if _, ok := t.nodes[id]; !ok {
+				findings = append(findings, Finding{
+					Edges:   []EdgeRef{{e.Source, e.Target}},
+					Message: fmt.Sprintf("edge %s -> %s refers to unknown node %q", e.Source, e.Target, id),
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// checkCycles reports cycles that requests can't leave for a node with no
+// downstream. No request entering one could ever finish, so the builder
+// refuses them too.
+func checkCycles(config *ArchitectureConfig) []Finding {
+	t := newTopology(config)
+	in := make(map[string][]string)
+	var sinks []string
+	for _, id := range t.ids {
+		if len(t.out[id]) == 0 {
+			sinks = append(sinks, id)
+		}
+		for _, tgt := range t.out[id] {
+			in[tgt] = append(in[tgt], id)
+		}
+	}
+	// Walk back from the sinks to find every node with a way out.
+	exits := make(map[string]bool)
+	stack := sinks
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if exits[id] {
+			continue
+		}
+		exits[id] = true
+		stack = append(stack, in[id]...)
+	}
+
+	var findings []Finding
+	reported := make(map[string]bool)
+	for _, id := range t.ids {
+		if exits[id] || reported[id] {
+			continue
+		}
+		reach := t.reachable(t.out[id]...)
+		if !reach[id] {
+			continue
+		}
+		// The cycle through id: the nodes it reaches that reach it back.
+		var cycle []string
+		for _, n := range t.ids {
+			if reach[n] && t.reachable(t.out[n]...)[id] {
+				cycle = append(cycle, n)
+				reported[n] = true
+			}
+		}
+		findings = append(findings, Finding{
+			Nodes:   cycle,
+			Message: fmt.Sprintf("cycle through %s has no way out to a node without downstream; no request entering it can finish", strings.Join(cycle, ", ")),
+		})
+	}
+	return findings
+}
+
+func checkDatabaseDownstream(config *ArchitectureConfig) []Finding {
+	t := newTopology(config)
+	var findings []Finding
+	for _, id := range t.ofKind("database") {
+		if len(t.out[id]) == 0 {
+			continue
+		}
+		f := Finding{Nodes: []string{id}, Message: fmt.Sprintf("database %s has downstream edges; databases don't send requests on", id)}
+		for _, tgt := range t.out[id] {
+			f.Edges = append(f.Edges, EdgeRef{id, tgt})
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// passThrough are node types that serve nothing themselves (caches serve
+// hits, but misses and writes go on).
+var passThrough = map[string]bool{
+	"loadbalancer": true, "dbrouter": true, "cache": true, "queue": true, "circuitbreaker": true, "gateway": true,
+}
+
+func checkDeadEnds(config *ArchitectureConfig) []Finding {
+	t := newTopology(config)
+	var findings []Finding
+	for _, id := range t.ids {
+		if passThrough[t.kind(id)] && len(t.out[id]) == 0 {
+			findings = append(findings, Finding{
+				Nodes:   []string{id},
+				Message: fmt.Sprintf("%s %s has no downstream; requests it passes on are lost", t.kind(id), id),
+			})
+		}
+	}
+	return findings
+}
+
+func checkClientSinks(config *ArchitectureConfig) []Finding {
+	t := newTopology(config)
+	var findings []Finding
+	for _, id := range t.ofKind("client") {
+		served := false
+		for n := range t.reachable(id) {
+			served = served || t.kind(n) == "appserver" || t.kind(n) == "database"
+		}
+		if !served {
+			findings = append(findings, Finding{
+				Nodes:   []string{id},
+				Message: fmt.Sprintf("client %s has no path to an app server or database; none of its requests can succeed", id),
+			})
+		}
+	}
+	return findings
+}
+
+func checkRouterPrimaries(config *ArchitectureConfig) []Finding {
+	t := newTopology(config)
+	var findings []Finding
+	for _, id := range t.ofKind("dbrouter") {
+		if len(t.out[id]) == 0 || t.nodes[id].ReadRatio >= 1 {
+			continue
+		}
+		primary := false
+		for _, tgt := range t.out[id] {
+			// The router sends writes to anything that isn't a replica.
+			primary = primary || t.kind(tgt) != "database" || !t.nodes[tgt].IsReplica
+		}
+		if !primary {
+			findings = append(findings, Finding{
+				Nodes:   []string{id},
+				Message: fmt.Sprintf("DB router %s has no primary database; every write sent to it fails", id),
+			})
+		}
+	}
+	return findings
+}
+
+func checkReachable(config *ArchitectureConfig) []Finding {
+	t := newTopology(config)
+	clients := t.ofKind("client")
+	if len(clients) == 0 {
+		// Traffic is injected at every client (Graph.Entries); without
+		// any, every node would be reported, which helps nobody.
+		return nil
+	}
+	seen := t.reachable(clients...)
+	var findings []Finding
+	for _, id := range t.ids {
+		if !seen[id] {
+			findings = append(findings, Finding{
+				Nodes:   []string{id},
+				Message: fmt.Sprintf("no client sends traffic to %s", id),
+			})
+		}
+	}
+	return findings
+}
@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+// codes returns the rules of findings, in order.
+func codes(findings []Finding) []string {
+	var got []string
+	for _, f := range findings {
+		got = append(got, f.Rule)
+	}
+	return got
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*ArchitectureConfig)
+		want   []string
+	}{
+		{"clean", func(*ArchitectureConfig) {}, nil},
+		{"duplicate ID", func(c *ArchitectureConfig) {
+			c.Nodes = append(c.Nodes, NodeConfig{ID: "db", Type: "database"})
+		}, []string{"duplicate-id"}},
+		{"unknown type", func(c *ArchitectureConfig) {
+			setNode(c, "db", func(nc *NodeConfig) { nc.Type = "mainframe" })
+		}, []string{"unknown-type"}},
+		{"dangling edge", func(c *ArchitectureConfig) {
+			c.Edges = append(c.Edges, EdgeConfig{Source: "api", Target: "cache"})
+		}, []string{"dangling-edge"}},
+		{"cycle without exit", func(c *ArchitectureConfig) {
+			c.Edges = []EdgeConfig{{Source: "c", Target: "api"}, {Source: "api", Target: "api"}}
+			removeNode(c, "db")
+		}, []string{"cycle"}},
+		{"database downstream", func(c *ArchitectureConfig) {
+			c.Nodes = append(c.Nodes, NodeConfig{ID: "db2", Type: "database"})
+			c.Edges = append(c.Edges, EdgeConfig{Source: "db", Target: "db2"})
+		}, []string{"database-downstream"}},
+		{"dead end", func(c *ArchitectureConfig) {
+			c.Nodes = append(c.Nodes, NodeConfig{ID: "lb", Type: "loadbalancer"})
+			c.Edges = append(c.Edges, EdgeConfig{Source: "api", Target: "lb"})
+		}, []string{"dead-end"}},
+		{"no sink", func(c *ArchitectureConfig) {
+			c.Nodes = append(c.Nodes, NodeConfig{ID: "mobile", Type: "client", RPS: 10}, NodeConfig{ID: "q", Type: "queue"})
+			c.Edges = append(c.Edges, EdgeConfig{Source: "mobile", Target: "q"})
+		}, []string{"dead-end", "no-sink"}},
+		{"no primary", func(c *ArchitectureConfig) {
+			c.Nodes = append(c.Nodes, NodeConfig{ID: "router", Type: "dbrouter"})
+			c.Edges = []EdgeConfig{{Source: "c", Target: "api"}, {Source: "api", Target: "router"}, {Source: "router", Target: "db"}}
+			setNode(c, "db", func(nc *NodeConfig) { nc.IsReplica = true })
+		}, []string{"no-primary"}},
+		{"unreachable", func(c *ArchitectureConfig) {
+			c.Nodes = append(c.Nodes, NodeConfig{ID: "batch", Type: "appserver"})
+			c.Edges = append(c.Edges, EdgeConfig{Source: "batch", Target: "db"})
+		}, []string{"unreachable"}},
+		{"errors first", func(c *ArchitectureConfig) {
+			c.Nodes = append(c.Nodes, NodeConfig{ID: "batch", Type: "appserver"})
+			c.Edges = append(c.Edges, EdgeConfig{Source: "batch", Target: "db"}, EdgeConfig{Source: "api", Target: "cache"})
+		}, []string{"dangling-edge", "unreachable"}},
+		{"build", func(c *ArchitectureConfig) {
+			c.Scenario = &Scenario{Phases: []TrafficPhase{{Shape: "square"}}}
+		}, []string{"build"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := chain(100)
+			tt.change(config)
+			if got := codes(Validate(config, DefaultRules)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findings %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Each warning describes what a run of the architecture then shows.
+func TestWarningsShowInARun(t *testing.T) {
+	t.Run("dead end loses requests", func(t *testing.T) {
+		config := chain(100)
+		config.Nodes = append(config.Nodes, NodeConfig{ID: "lb", Type: "loadbalancer"})
+		config.Edges = []EdgeConfig{{Source: "c", Target: "lb"}}
+		if rate := run(t, config, 5).Summary.SuccessRate; rate != 0 {
+			t.Errorf("success rate %v, want 0", rate)
+		}
+	})
+	t.Run("no sink fails everything", func(t *testing.T) {
+		config := &ArchitectureConfig{Seed: 1, Nodes: []NodeConfig{{ID: "c", Type: "client", RPS: 100}}}
+		if got := codes(Validate(config, DefaultRules)); !reflect.DeepEqual(got, []string{"no-sink"}) {
+			t.Fatalf("findings %v, want no-sink", got)
+		}
+		if rate := run(t, config, 5).Summary.SuccessRate; rate != 0 {
+			t.Errorf("success rate %v, want 0", rate)
+		}
+	})
+	t.Run("no primary fails every write", func(t *testing.T) {
+		config := chain(100)
+		config.Nodes = append(config.Nodes, NodeConfig{ID: "router", Type: "dbrouter"})
+		config.Edges = []EdgeConfig{{Source: "c", Target: "router"}, {Source: "router", Target: "db"}}
+		setNode(config, "db", func(nc *NodeConfig) { nc.IsReplica = true })
+		removeNode(config, "api")
+		if rate := run(t, config, 5).Summary.SuccessRate; !near(rate, defaultReadRatio, 1e-9) {
+			t.Errorf("success rate %v, want only the reads to succeed", rate)
+		}
+	})
+	t.Run("unreachable node gets no traffic", func(t *testing.T) {
+		config := chain(100)
+		config.Nodes = append(config.Nodes, NodeConfig{ID: "batch", Type: "appserver"})
+		config.Edges = append(config.Edges, EdgeConfig{Source: "batch", Target: "db"})
+		if tp := nodeSummary(t, run(t, config, 5), "batch").AvgThroughput; tp != 0 {
+			t.Errorf("batch served %v rps, want none", tp)
+		}
+	})
+}
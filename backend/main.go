@@ -26,6 +26,8 @@ func main() {
 
 	// API Routes
 	mux.HandleFunc("/api/simulate", handleSimulate)
+	mux.HandleFunc("/api/run", handleRun)
+	mux.HandleFunc("/api/validate", handleValidate)
 	mux.HandleFunc("/api/ws/", handleWebSocket)
 	mux.HandleFunc("/api/simulate/", handleSessionAction)
 
@@ -116,6 +118,72 @@ func handleSimulate(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// maxRunTicks caps how many ticks a single headless run may simulate.
+const maxRunTicks = 3600
+
+// POST /api/run — run a topology headless for N ticks and return the summary
+// (and, with "series": true, every tick)
+func handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The body is an ArchitectureConfig plus the number of ticks to run and
+	// whether to return the per-tick series.
+	body := struct {
+		engine.ArchitectureConfig
+		Ticks  int  `json:"ticks"`
+		Series bool `json:"series,omitempty"`
+	}{Ticks: 60}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if body.Ticks < 1 || body.Ticks > maxRunTicks {
+		http.Error(w, fmt.Sprintf("ticks must be between 1 and %d", maxRunTicks), http.StatusBadRequest)
+		return
+	}
+
+	graph, err := engine.BuildGraphFromConfig(&body.ArchitectureConfig)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to build graph: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(engine.RunFor(graph, body.Ticks, body.Series))
+}
+
+// POST /api/validate — lint a topology without running it
+func handleValidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var config engine.ArchitectureConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	findings := engine.Validate(&config, engine.DefaultRules)
+	valid := true
+	for _, f := range findings {
+		valid = valid && f.Severity != engine.SeverityError
+	}
+	if findings == nil {
+		findings = []engine.Finding{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"valid":    valid,
+		"findings": findings,
+	})
+}
+
 // GET /api/ws/{sessionId} — WebSocket for streaming metrics
 func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/ws/"), "/")
@@ -152,7 +220,12 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	log.Printf("WebSocket closed for session %s", sessionID)
 }
 
-// POST /api/simulate/{sessionId}/stop or /traffic
+// maxStepTicks caps how many ticks a single step request may advance.
+const maxStepTicks = 1000
+
+// POST /api/simulate/{sessionId}/{action}
+// Actions: stop, traffic, toggle, config, update-graph, reset-queues,
+// pause, resume, step, clock, scenario, chaos, degrade
 func handleSessionAction(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -185,17 +258,15 @@ func handleSessionAction(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Session not found", http.StatusNotFound)
 			return
 		}
+		// Traffic comes from the clients' own RPS (set through
+		// config); this only toggles the spike.
 		var body struct {
-			RPS   float64 `json:"rps"`
-			Spike *bool   `json:"spike,omitempty"`
+			Spike *bool `json:"spike,omitempty"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 			http.Error(w, "Invalid body", http.StatusBadRequest)
 			return
 		}
-		if body.RPS > 0 {
-			session.Simulator.SetTrafficRPS(body.RPS)
-		}
 		if body.Spike != nil {
 			session.Simulator.SetSpike(*body.Spike)
 		}
@@ -223,6 +294,37 @@ func handleSessionAction(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"status": "toggled"})
 
+	case "degrade":
+		session, ok := sessionMgr.Get(sessionID)
+		if !ok {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		// A null or missing degradation restores the node.
+		var body struct {
+			NodeID      string              `json:"nodeId"`
+			Degradation *engine.Degradation `json:"degradation"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid body", http.StatusBadRequest)
+			return
+		}
+		found, err := session.Simulator.SetNodeDegraded(body.NodeID, body.Degradation)
+		if !found {
+			http.Error(w, "Node not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		status := "degraded"
+		if body.Degradation == nil {
+			status = "restored"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": status})
+
 	case "config":
 		session, ok := sessionMgr.Get(sessionID)
 		if !ok {
@@ -243,10 +345,6 @@ func handleSessionAction(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Invalid body", http.StatusBadRequest)
 			return
 		}
-		// If RPS is set, update the simulator traffic
-		if body.RPS > 0 {
-			session.Simulator.SetTrafficRPS(body.RPS)
-		}
 		ir := false
 		if body.IsReplica != nil {
 			ir = *body.IsReplica
@@ -287,6 +385,129 @@ func handleSessionAction(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"status": "graph_updated"})
 
+	case "pause", "resume":
+		session, ok := sessionMgr.Get(sessionID)
+		if !ok {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		status := "paused"
+		if action == "pause" {
+			session.Simulator.Pause()
+		} else {
+			session.Simulator.Resume()
+			status = "running"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": status})
+
+	case "step":
+		session, ok := sessionMgr.Get(sessionID)
+		if !ok {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		// Body is optional: {"ticks": N}, default 1
+		body := struct {
+			Ticks int `json:"ticks"`
+		}{Ticks: 1}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "Invalid body", http.StatusBadRequest)
+				return
+			}
+		}
+		if body.Ticks < 1 || body.Ticks > maxStepTicks {
+			http.Error(w, fmt.Sprintf("ticks must be between 1 and %d", maxStepTicks), http.StatusBadRequest)
+			return
+		}
+		results := session.Simulator.Step(body.Ticks)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "stepped",
+			"paused": session.Simulator.Paused(),
+			"ticks":  results,
+		})
+
+	case "clock":
+		session, ok := sessionMgr.Get(sessionID)
+		if !ok {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		var body struct {
+			Speed       float64 `json:"speed,omitempty"`       // simulated seconds per wall-clock second
+			TickSeconds float64 `json:"tickSeconds,omitempty"` // simulated seconds per tick
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid body", http.StatusBadRequest)
+			return
+		}
+		if body.Speed > 0 {
+			session.Simulator.SetSpeed(body.Speed)
+		}
+		if body.TickSeconds > 0 {
+			session.Simulator.SetTickSeconds(body.TickSeconds)
+		}
+		tickSeconds, speed, simTime := session.Simulator.Clock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":      "clock_updated",
+			"tickSeconds": tickSeconds,
+			"speed":       speed,
+			"simTime":     simTime,
+		})
+
+	case "scenario":
+		session, ok := sessionMgr.Get(sessionID)
+		if !ok {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		// Body is a scenario; an empty body or null detaches the current one.
+		var scenario *engine.Scenario
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&scenario); err != nil {
+				http.Error(w, "Invalid body", http.StatusBadRequest)
+				return
+			}
+		}
+		if err := session.Simulator.SetScenario(scenario); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid scenario: %v", err), http.StatusBadRequest)
+			return
+		}
+		status := "scenario_set"
+		if scenario == nil {
+			status = "scenario_cleared"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": status})
+
+	case "chaos":
+		session, ok := sessionMgr.Get(sessionID)
+		if !ok {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		// Body is a chaos plan; an empty body or null detaches the current one.
+		var plan *engine.ChaosPlan
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+				http.Error(w, "Invalid body", http.StatusBadRequest)
+				return
+			}
+		}
+		if err := session.Simulator.SetChaos(plan); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid chaos plan: %v", err), http.StatusBadRequest)
+			return
+		}
+		status := "chaos_set"
+		if plan == nil {
+			status = "chaos_cleared"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": status})
+
 	case "reset-queues":
 		session, ok := sessionMgr.Get(sessionID)
 		if !ok {
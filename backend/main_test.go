@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"arkitect/engine"
+)
+
+const runTopology = `"seed": 1,
+	"nodes": [
+		{"id": "c", "type": "client", "rps": 100},
+		{"id": "api", "type": "appserver", "maxRPS": 1000, "baseLatency": 20}
+	],
+	"edges": [{"source": "c", "target": "api"}]`
+
+func TestHandleRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		ticks  int // in the series
+	}{
+		{"summary only", `{` + runTopology + `, "ticks": 10}`, http.StatusOK, 0},
+		{"with series", `{` + runTopology + `, "ticks": 10, "series": true}`, http.StatusOK, 10},
+		{"default length", `{` + runTopology + `, "series": true}`, http.StatusOK, 60},
+		{"too long", `{` + runTopology + `, "ticks": 3601}`, http.StatusBadRequest, 0},
+		{"no ticks", `{` + runTopology + `, "ticks": 0}`, http.StatusBadRequest, 0},
+		{"bad graph", `{"nodes": [], "ticks": 10}`, http.StatusBadRequest, 0},
+		{"bad JSON", `{`, http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handleRun(rec, httptest.NewRequest(http.MethodPost, "/api/run", strings.NewReader(tt.body)))
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var result engine.RunResult
+			if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Ticks) != tt.ticks {
+				t.Errorf("%d ticks in the series, want %d", len(result.Ticks), tt.ticks)
+			}
+			if result.Summary.AvgTotalRPS != 100 || result.Summary.SuccessRate != 1 {
+				t.Errorf("summary %+v, want 100 rps all succeeding", result.Summary)
+			}
+		})
+	}
+}
+
+func TestHandleRunMethod(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleRun(rec, httptest.NewRequest(http.MethodGet, "/api/run", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -62,18 +62,13 @@ function App() {
   const [spikeOn, setSpikeOn] = useState(false);
   const [bottleneckIds, setBottleneckIds] = useState([]);
   const [tickCount, setTickCount] = useState(0);
+  const [latestTick, setLatestTick] = useState(null);
   const [selectedNodeId, setSelectedNodeId] = useState(null);
   const [isSidebarOpen, setIsSidebarOpen] = useState(false);
   const wsRef = useRef(null);
   const reactFlowWrapper = useRef(null);
   const [reactFlowInstance, setReactFlowInstance] = useState(null);
 
-  // Get traffic RPS from the first client node, or default 100
-  const getTrafficRPS = () => {
-    const clientNode = nodes.find((n) => n.type === 'client');
-    return clientNode?.data?.rps || 100;
-  };
-
   const selectedNode = nodes.find((n) => n.id === selectedNodeId) || null;
 
   const onNodesChange = useCallback((changes) => {
@@ -188,7 +183,6 @@ function App() {
   const syncSimulation = async (currentNodes, currentEdges) => {
     if (!isRunning || !sessionId) return;
     
-    const trafficRPS = currentNodes.find((n) => n.type === 'client')?.data?.rps || 100;
     const payload = {
       nodes: currentNodes.map((n) => ({
         id: n.id,
@@ -206,7 +200,6 @@ function App() {
         source: e.source,
         target: e.target,
       })),
-      trafficRPS: trafficRPS,
     };
 
     try {
@@ -350,8 +343,6 @@ function App() {
 
   // — Simulation control —
   const startSimulation = async () => {
-    const trafficRPS = getTrafficRPS();
-
     const payload = {
       nodes: nodes.map((n) => ({
         id: n.id,
@@ -369,7 +360,6 @@ function App() {
         source: e.source,
         target: e.target,
       })),
-      trafficRPS: trafficRPS,
     };
 
     try {
@@ -391,6 +381,7 @@ function App() {
       ws.onmessage = (event) => {
         const tick = JSON.parse(event.data);
         setTickCount(tick.tick);
+        setLatestTick(tick);
         setBottleneckIds(tick.bottleneckIds || []);
 
         // Update node data with metrics
@@ -466,6 +457,7 @@ function App() {
     setSessionId(null);
     setBottleneckIds([]);
     setTickCount(0);
+    setLatestTick(null);
 
     // Reset node metrics
     setNodes((nds) => nds.map((n) => ({ ...n, data: { ...n.data, metrics: null } })));
@@ -524,7 +516,9 @@ function App() {
     }
   };
 
-  const trafficRPS = getTrafficRPS();
+  // Traffic injected by all clients in the latest tick, as the engine measured it
+  const trafficRPS = Math.round(latestTick?.totalRPS || 0);
+  const clientTraffic = latestTick?.clients || [];
 
   return (
     <div className="flex h-screen w-full bg-[#0a0a0c] text-slate-200 overflow-hidden font-sans relative">
@@ -575,8 +569,18 @@ function App() {
           <div className="bg-white/5 rounded-2xl p-4 border border-white/5">
             <div className="flex items-center justify-between mb-2">
               <span className="text-xs font-semibold text-slate-400 uppercase tracking-wider">System Traffic</span>
-              <span className="text-[10px] text-indigo-400 font-bold bg-indigo-500/10 px-2 py-0.5 rounded-full border border-indigo-500/20">{trafficRPS} RPS</span>
+              <span className="text-[10px] text-indigo-400 font-bold bg-indigo-500/10 px-2 py-0.5 rounded-full border border-indigo-500/20">{isRunning ? `${trafficRPS} RPS` : 'Idle'}</span>
             </div>
+            {clientTraffic.length > 1 && (
+              <div className="flex flex-col gap-1 mb-3">
+                {clientTraffic.map((c) => (
+                  <div key={c.id} className="flex items-center justify-between text-[10px] text-slate-500">
+                    <span className="truncate">{c.label || c.id}</span>
+                    <span className="font-mono">{Math.round(c.injectedRPS)} RPS</span>
+                  </div>
+                ))}
+              </div>
+            )}
             
             <button
               onClick={toggleSpike}